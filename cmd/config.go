@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"ip2country/internal/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration",
+	Long:  "Load the configuration file and environment like the run command does, and report every problem found. Exits with a non-zero code when the configuration is invalid.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := config.LoadConfig(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Configuration in %s is valid\n", config.Source())
+	},
+}
+
+func init() {
+	configCmd.AddCommand(validateConfigCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"ip2country/internal/dbreport"
+)
+
+var diffDBCmd = &cobra.Command{
+	Use:   "diff-db <old> <new>",
+	Short: "Compare two database files",
+	Long: "Load two GeoLite2 zips or geodata.dat files and report the networks added, removed and moved to another " +
+		"country or city, along with the networks gained and lost by every country. With --max-changes or " +
+		"--max-changed-percent, exits with code 1 when the changes exceed the threshold, so that a new release can be " +
+		"held back in CI. Exits with code 2 when a file cannot be loaded.",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		if format != lookupFormatTable && format != lookupFormatJSON {
+			fmt.Fprintf(os.Stderr, "Unknown output format %s, expected %s or %s\n", format, lookupFormatTable, lookupFormatJSON)
+			os.Exit(2)
+		}
+		// Progress of the loading is noise for a command line tool, only problems are reported
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+
+		diff, err := dbreport.DiffFiles(args[0], args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if format == lookupFormatJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(diff)
+		} else {
+			limit, _ := cmd.Flags().GetInt("limit")
+			err = writeDiff(os.Stdout, diff, limit)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		maxChanges, _ := cmd.Flags().GetInt("max-changes")
+		maxPercent, _ := cmd.Flags().GetFloat64("max-changed-percent")
+		if reason := exceedsThreshold(diff, maxChanges, maxPercent); reason != "" {
+			fmt.Fprintln(os.Stderr, reason)
+			os.Exit(1)
+		}
+	},
+}
+
+// exceedsThreshold tells why the changes of diff exceed the thresholds, empty when they do not. Negative thresholds
+// are not checked.
+func exceedsThreshold(diff *dbreport.Diff, maxChanges int, maxPercent float64) string {
+	if maxChanges >= 0 && diff.Changes > maxChanges {
+		return fmt.Sprintf("%d networks changed, more than the %d allowed", diff.Changes, maxChanges)
+	}
+	if maxPercent >= 0 && diff.ChangedPercent > maxPercent {
+		return fmt.Sprintf("%.2f%% of the networks changed, more than the %.2f%% allowed", diff.ChangedPercent, maxPercent)
+	}
+	return ""
+}
+
+// writeDiff prints a diff for people, listing up to limit examples of every kind of change
+func writeDiff(out io.Writer, d *dbreport.Diff, limit int) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Old:\t%s (%d networks)\n", d.Old, d.OldNetworks)
+	fmt.Fprintf(w, "New:\t%s (%d networks)\n", d.New, d.NewNetworks)
+	fmt.Fprintf(w, "Added:\t%d\n", len(d.Added))
+	fmt.Fprintf(w, "Removed:\t%d\n", len(d.Removed))
+	fmt.Fprintf(w, "Country changed:\t%d\n", len(d.CountryChanged))
+	fmt.Fprintf(w, "City changed:\t%d\n", len(d.CityChanged))
+	fmt.Fprintf(w, "Total changes:\t%d (%.2f%%)\n", d.Changes, d.ChangedPercent)
+
+	if len(d.Countries) > 0 && limit > 0 {
+		fmt.Fprintf(w, "\nCOUNTRY\tADDED\tREMOVED\tMOVED IN\tMOVED OUT\tNET\n")
+		for _, m := range d.Countries[:min(limit, len(d.Countries))] {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%+d\n", dash(m.Country), m.Added, m.Removed, m.MovedIn, m.MovedOut, m.Net)
+		}
+		if len(d.Countries) > limit {
+			fmt.Fprintf(w, "... and %d more countries\n", len(d.Countries)-limit)
+		}
+	}
+
+	location := func(l dbreport.Location) string {
+		country := dash(cmp.Or(l.CountryCode, l.Country))
+		if l.City == "" {
+			return country
+		}
+		return country + " " + l.City
+	}
+	examples(w, "Added networks", d.Added, limit, func(n dbreport.Network) string {
+		return n.Network + "\t" + location(n.Location)
+	})
+	examples(w, "Removed networks", d.Removed, limit, func(n dbreport.Network) string {
+		return n.Network + "\t" + location(n.Location)
+	})
+	change := func(c dbreport.Change) string {
+		return c.Network + "\t" + location(c.Before) + " -> " + location(c.After)
+	}
+	examples(w, "Networks moved to another country", d.CountryChanged, limit, change)
+	examples(w, "Networks moved to another city", d.CityChanged, limit, change)
+	return w.Flush()
+}
+
+func init() {
+	diffDBCmd.Flags().StringP("output", "o", lookupFormatTable, "Output format: table or json")
+	diffDBCmd.Flags().Int("limit", 10, "Number of countries and examples listed for every kind of change, 0 for none")
+	diffDBCmd.Flags().Int("max-changes", -1, "Exit with code 1 when more networks changed, -1 to disable")
+	diffDBCmd.Flags().Float64("max-changed-percent", -1, "Exit with code 1 when a larger percentage of the old networks changed, -1 to disable")
+	rootCmd.AddCommand(diffDBCmd)
+}
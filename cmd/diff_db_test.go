@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"ip2country/internal/dbreport"
+)
+
+func TestExceedsThreshold(t *testing.T) {
+	diff := &dbreport.Diff{Changes: 10, ChangedPercent: 2.5}
+	tests := []struct {
+		name       string
+		maxChanges int
+		maxPercent float64
+		exceeded   bool
+	}{
+		{"no thresholds", -1, -1, false},
+		{"changes within", 10, -1, false},
+		{"changes over", 9, -1, true},
+		{"percent within", -1, 2.5, false},
+		{"percent over", -1, 2, true},
+		{"zero allows no change", 0, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := exceedsThreshold(diff, tt.maxChanges, tt.maxPercent); (reason != "") != tt.exceeded {
+				t.Errorf("Expected exceeded %v, got %q", tt.exceeded, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ip2country/internal/config"
+	"ip2country/internal/enrich"
+	stores "ip2country/internal/ip2country/store"
+	"ip2country/pkg/store"
+)
+
+var enrichCmd = &cobra.Command{
+	Use:   "enrich [file...]",
+	Short: "Add the location of IP addresses to CSV, TSV or JSON Lines records",
+	Long: "Read CSV, TSV or JSON Lines records from the files given, or from stdin when there are none, and add the country, " +
+		"city and ISO country code of the IP address found in --column or --field. Records are looked up concurrently and " +
+		"written in the order they were read, to stdout or the --out file. Only the local data store is used without --db, " +
+		"as a remote one would get every address of the records. A report of the records processed, the addresses not " +
+		"found, the failed lookups and the throughput is printed to stderr. Exits with code 2 on errors or failed lookups.",
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := enrichOptions(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		// Progress of the store is noise for a command line tool, only problems are reported
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+
+		s, err := openEnrichStore(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer stores.Close(s)
+
+		enricher, err := enrich.New(s, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err := runEnrich(cmd, enricher, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		stats := enricher.Stats()
+		fmt.Fprintf(os.Stderr, "%d records, %d enriched, %d not found, %d failed, %d without an IP address in %s (%.0f records/s)\n",
+			stats.Records, stats.Enriched, stats.NotFound, stats.Failed, stats.Invalid, stats.Elapsed.Round(time.Millisecond),
+			stats.Throughput())
+		if stats.Failed > 0 {
+			os.Exit(2)
+		}
+	},
+}
+
+// openEnrichStore opens the database file of --db, or the local data store of the configuration. Other data stores
+// are refused, as enriching would send every address of the records to them.
+func openEnrichStore(cmd *cobra.Command) (store.Store, error) {
+	if path, _ := cmd.Flags().GetString("db"); path != "" {
+		return stores.OpenFileStore(path)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnrichStore(cfg); err != nil {
+		return nil, err
+	}
+	return openConfiguredStore(cmd, cfg)
+}
+
+// checkEnrichStore refuses the configured data stores other than the local one
+func checkEnrichStore(cfg *config.Config) error {
+	if cfg.ActiveDataStore != config.Local {
+		return fmt.Errorf("enriching with the %s data store would send it every address of the records, set --db to a database file",
+			cfg.ActiveDataStore)
+	}
+	return nil
+}
+
+// enrichOptions reads the flags, inferring the format from the extension of the first file when it is not set
+func enrichOptions(cmd *cobra.Command, args []string) (enrich.Options, error) {
+	flags := cmd.Flags()
+	opts := enrich.Options{}
+	opts.Format, _ = flags.GetString("format")
+	opts.Column, _ = flags.GetString("column")
+	opts.NoHeader, _ = flags.GetBool("no-header")
+	opts.Field, _ = flags.GetString("field")
+	opts.Prefix, _ = flags.GetString("prefix")
+	opts.Workers, _ = flags.GetInt("workers")
+	if opts.Format == "" && len(args) > 0 {
+		opts.Format = enrichFormat(args[0])
+	}
+	if opts.Format == "" {
+		return opts, fmt.Errorf("cannot tell the format of the records, set --format to %s, %s or %s",
+			enrich.FormatCSV, enrich.FormatTSV, enrich.FormatJSONL)
+	}
+	return opts, nil
+}
+
+// enrichFormat returns the format of a file from its extension, empty when unknown
+func enrichFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return enrich.FormatCSV
+	case ".tsv", ".tab":
+		return enrich.FormatTSV
+	case ".jsonl", ".ndjson":
+		return enrich.FormatJSONL
+	}
+	return ""
+}
+
+// runEnrich enriches the files of args, or stdin, into the --out file or stdout
+func runEnrich(cmd *cobra.Command, enricher *enrich.Enricher, args []string) error {
+	var out io.Writer = os.Stdout
+	if path, _ := cmd.Flags().GetString("out"); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if len(args) == 0 {
+		return enricher.Process(cmd.Context(), os.Stdin, out)
+	}
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = enricher.Process(cmd.Context(), file, out)
+		_ = file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	enrichCmd.Flags().String("db", "", "Database file to look up in, a GeoLite2 zip or a geodata.dat file (default the configured local data store)")
+	enrichCmd.Flags().StringP("format", "f", "", "Format of the records: csv, tsv or jsonl (default from the file extension)")
+	enrichCmd.Flags().String("column", "", "Column of the IP address in CSV and TSV records, its header name or position starting at 1")
+	enrichCmd.Flags().Bool("no-header", false, "CSV and TSV records have no header row, --column is then a position")
+	enrichCmd.Flags().String("field", "", "Path of the IP address in JSON records, keys and array indexes separated by dots, e.g. client.ip")
+	enrichCmd.Flags().String("prefix", "geo_", "Prefix of the added columns or keys")
+	enrichCmd.Flags().Int("workers", 0, "Number of concurrent lookups (default the number of CPUs)")
+	enrichCmd.Flags().StringP("out", "o", "", "File to write the enriched records to (default stdout)")
+	rootCmd.AddCommand(enrichCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"testing"
+
+	"ip2country/internal/config"
+)
+
+func TestCheckEnrichStore(t *testing.T) {
+	tests := []struct {
+		store    config.DatabaseType
+		expected bool
+	}{
+		{store: config.Local, expected: true},
+		{store: config.API},
+		{store: config.Relational},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.store), func(t *testing.T) {
+			err := checkEnrichStore(&config.Config{ActiveDataStore: tt.store})
+			if (err == nil) != tt.expected {
+				t.Errorf("Expected the %s data store to be accepted: %v, got %v", tt.store, tt.expected, err)
+			}
+		})
+	}
+}
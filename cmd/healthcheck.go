@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ip2country/internal/config"
+	"ip2country/internal/router"
+	"ip2country/internal/tlsconfig"
+)
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check whether a running service is ready",
+	Long: "Query the readiness endpoint of a running service. Exits with a non-zero code when it is not ready, for use as a container HEALTHCHECK. " +
+		"The endpoint is reached through the configured listeners, preferring internal ones and Unix sockets. " +
+		"With mutual TLS, the check presents the certificate of --cert and --key, or of tls.healthCheckCertFile and tls.healthCheckKeyFile.",
+	Run: func(cmd *cobra.Command, args []string) {
+		url, _ := cmd.Flags().GetString("url")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		certFile, _ := cmd.Flags().GetString("cert")
+		keyFile, _ := cmd.Flags().GetString("key")
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
+			os.Exit(1)
+		}
+		if certFile == "" && keyFile == "" {
+			certFile, keyFile = cfg.TLS.HealthCheckCertFile, cfg.TLS.HealthCheckKeyFile
+		}
+		socket := ""
+		if url == "" {
+			url, socket, err = healthTarget(cfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		client, err := healthClient(cfg.TLS, socket, certFile, keyFile, timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		body, err := checkHealth(client, url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(body)
+	},
+}
+
+// healthTarget returns the readiness URL of the service and, for a Unix socket, its path. Internal listeners are
+// preferred as they are not rate limited, then Unix sockets as they need no TLS.
+// Sockets passed by systemd cannot be told apart from their configuration, so they are not used.
+func healthTarget(cfg *config.Config) (string, string, error) {
+	listeners := slices.Clone(router.ListenerConfigs(cfg))
+	rank := func(l config.ListenerConfig) int {
+		r := 0
+		if l.Profile != config.ProfileInternal {
+			r += 2
+		}
+		if l.Network != config.ListenerUnix {
+			r++
+		}
+		return r
+	}
+	slices.SortStableFunc(listeners, func(a, b config.ListenerConfig) int { return cmp.Compare(rank(a), rank(b)) })
+
+	for _, l := range listeners {
+		switch cmp.Or(l.Network, config.ListenerTCP) {
+		case config.ListenerUnix:
+			return "http://localhost/readyz", l.Address, nil
+		case config.ListenerTCP:
+			host, port, err := net.SplitHostPort(l.Address)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid listener address %s: %w", l.Address, err)
+			}
+			// The service listens on every address, the check connects through the loopback
+			if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+				host = "127.0.0.1"
+				if ip != nil && ip.To4() == nil {
+					host = "::1"
+				}
+			}
+			scheme := "http"
+			if tlsconfig.Enabled(cfg.TLS) {
+				scheme = "https"
+			}
+			return fmt.Sprintf("%s://%s/readyz", scheme, net.JoinHostPort(host, port)), "", nil
+		}
+	}
+	return "", "", errors.New("no tcp or unix listener to reach the service through, set --url")
+}
+
+// healthClient returns the client of the check, connecting to the Unix socket at socket when it is set. The service
+// certificate is not issued for the loopback address the check connects to, so it is not verified. The certificate of
+// certFile and keyFile is presented when they are set, as the service rejects connections without one when it
+// requires client certificates.
+func healthClient(tlsCfg config.TLSConfig, socket, certFile, keyFile string, timeout time.Duration) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout}
+	transport := &http.Transport{}
+	if socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+	}
+	if tlsconfig.Enabled(tlsCfg) || certFile != "" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		if certFile != "" || keyFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+			}
+			transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	client.Transport = transport
+	return client, nil
+}
+
+// checkHealth queries the readiness endpoint at url and returns its answer, or why the service is not ready
+func checkHealth(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func init() {
+	healthcheckCmd.Flags().String("url", "", "Readiness URL to query (default /readyz on the configured listeners)")
+	healthcheckCmd.Flags().Duration("timeout", 3*time.Second, "Timeout of the check")
+	healthcheckCmd.Flags().String("cert", "", "Client certificate presented with mutual TLS (default tls.healthCheckCertFile)")
+	healthcheckCmd.Flags().String("key", "", "Private key of the client certificate (default tls.healthCheckKeyFile)")
+	rootCmd.AddCommand(healthcheckCmd)
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ip2country/internal/config"
+	"ip2country/internal/tlsconfig"
+)
+
+// writeCertificate issues a certificate for commonName, signed by the CA of caFile and caKeyFile or self-signed when
+// they are empty, and saves it in PEM files of dir
+func writeCertificate(t *testing.T, dir, commonName, caFile, caKeyFile string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, any(key)
+	if caFile == "" {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		ca, err := tls.LoadX509KeyPair(caFile, caKeyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, signerKey = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, commonName+".crt"), filepath.Join(dir, commonName+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHealthcheckMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	caFile, caKeyFile := writeCertificate(t, dir, "ca", "", "")
+	serverCert, serverKey := writeCertificate(t, dir, "server", caFile, caKeyFile)
+	clientCert, clientKey := writeCertificate(t, dir, "healthcheck", caFile, caKeyFile)
+
+	tlsCfg := config.TLSConfig{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: caFile, ClientAuth: config.TLSClientAuthRequire}
+	serverTLS, reloader, err := tlsconfig.NewServerConfig(tlsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reloader.Close() }()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ready"))
+	}))
+	server.TLS = serverTLS
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		healthy  bool
+	}{
+		{"without a client certificate", "", "", false},
+		{"with the health check certificate", clientCert, clientKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := healthClient(tlsCfg, "", tt.certFile, tt.keyFile, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := checkHealth(client, server.URL+"/readyz")
+			if healthy := err == nil && body == "ready"; healthy != tt.healthy {
+				t.Errorf("Expected healthy %v, got %q and error %v", tt.healthy, body, err)
+			}
+		})
+	}
+
+	if _, err := healthClient(tlsCfg, "", clientCert, filepath.Join(dir, "missing.key"), time.Second); err == nil {
+		t.Error("Expected an error for a missing client key")
+	}
+}
+
+func TestHealthTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected string
+		socket   string
+	}{
+		{
+			name:     "port without listeners",
+			cfg:      &config.Config{Port: 9090},
+			expected: "http://127.0.0.1:9090/readyz",
+		},
+		{
+			name: "internal listener preferred",
+			cfg: &config.Config{Listeners: []config.ListenerConfig{
+				{Network: config.ListenerTCP, Address: ":8080"},
+				{Network: config.ListenerUnix, Address: "/run/public.sock"},
+				{Network: config.ListenerUnix, Address: "/run/internal.sock", Profile: config.ProfileInternal},
+			}},
+			expected: "http://localhost/readyz",
+			socket:   "/run/internal.sock",
+		},
+		{
+			name: "unix socket preferred over tcp",
+			cfg: &config.Config{Listeners: []config.ListenerConfig{
+				{Network: config.ListenerTCP, Address: "[::]:8080"},
+				{Network: config.ListenerUnix, Address: "/run/ip2country.sock"},
+			}},
+			expected: "http://localhost/readyz",
+			socket:   "/run/ip2country.sock",
+		},
+		{
+			name: "unspecified IPv6 address over TLS",
+			cfg: &config.Config{
+				Listeners: []config.ListenerConfig{{Network: config.ListenerTCP, Address: "[::]:8443"}},
+				TLS:       config.TLSConfig{CertFile: "server.crt", KeyFile: "server.key"},
+			},
+			expected: "https://[::1]:8443/readyz",
+		},
+		{
+			name: "systemd sockets only",
+			cfg:  &config.Config{Listeners: []config.ListenerConfig{{Network: config.ListenerSystemd}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, socket, err := healthTarget(tt.cfg)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", url)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != tt.expected || socket != tt.socket {
+				t.Errorf("Expected %s on socket %q, got %s on socket %q", tt.expected, tt.socket, url, socket)
+			}
+		})
+	}
+}
+
+func TestHealthcheckUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ip2country.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ready"))
+	})}
+	go func() { _ = server.Serve(lis) }()
+	defer server.Close()
+
+	cfg := &config.Config{Listeners: []config.ListenerConfig{{Network: config.ListenerUnix, Address: socket}}}
+	url, target, err := healthTarget(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := healthClient(cfg.TLS, target, "", "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := checkHealth(client, url); err != nil || body != "ready" {
+		t.Errorf("Expected the service to be ready through its socket, got %q and error %v", body, err)
+	}
+}
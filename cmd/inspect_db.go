@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"ip2country/internal/dbgenerator"
+	"ip2country/internal/dbreport"
+)
+
+var inspectDBCmd = &cobra.Command{
+	Use:   "inspect-db <file>",
+	Short: "Summarize the contents of a database file",
+	Long: "Load a GeoLite2 zip or a geodata.dat file and print its networks by IP family and prefix length, the countries " +
+		"and cities covered, the share of the IPv4 space covered, duplicate and overlapping networks, and the blocks dropped " +
+		"during the import. Dropped blocks are only known when inspecting a zip. Exits with code 2 when the file cannot be loaded.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		if format != lookupFormatTable && format != lookupFormatJSON {
+			fmt.Fprintf(os.Stderr, "Unknown output format %s, expected %s or %s\n", format, lookupFormatTable, lookupFormatJSON)
+			os.Exit(2)
+		}
+		// Progress of the loading is noise for a command line tool, only problems are reported
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+
+		summary, err := dbreport.Inspect(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if format == lookupFormatJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(summary)
+		} else {
+			limit, _ := cmd.Flags().GetInt("limit")
+			err = writeSummary(os.Stdout, summary, limit)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	},
+}
+
+// writeSummary prints a summary for people, listing up to limit examples of every problem found
+func writeSummary(out io.Writer, s *dbreport.Summary, limit int) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "File:\t%s\n", s.Path)
+	if !s.BuildDate.IsZero() {
+		fmt.Fprintf(w, "Built:\t%s\n", s.BuildDate.Format("2006-01-02 15:04:05 MST"))
+	}
+	fmt.Fprintf(w, "Networks:\t%d (IPv4 %d, IPv6 %d)\n", s.Networks, s.IPv4.Networks, s.IPv6.Networks)
+	fmt.Fprintf(w, "Countries:\t%d\n", s.Countries)
+	fmt.Fprintf(w, "Cities:\t%d\n", s.Cities)
+	fmt.Fprintf(w, "IPv4 coverage:\t%.2f%%\n", s.IPv4Coverage)
+	fmt.Fprintf(w, "Invalid networks:\t%d\n", len(s.Invalid))
+	fmt.Fprintf(w, "Duplicate networks:\t%d\n", len(s.Duplicates))
+	fmt.Fprintf(w, "Overlapping networks:\t%d\n", len(s.Overlaps))
+	if s.Dropped == nil {
+		fmt.Fprintf(w, "Dropped blocks:\tnot recorded, inspect the zip the file was created from\n")
+	} else {
+		reasons := s.DroppedByReason()
+		fmt.Fprintf(w, "Dropped blocks:\t%d (%s %d, %s %d)\n", len(s.Dropped),
+			dbgenerator.DropEmptyGeonameID, reasons[dbgenerator.DropEmptyGeonameID],
+			dbgenerator.DropUnknownLocation, reasons[dbgenerator.DropUnknownLocation])
+	}
+
+	for _, family := range []struct {
+		name string
+		dbreport.Family
+	}{{"IPv4", s.IPv4}, {"IPv6", s.IPv6}} {
+		if family.Networks == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s prefix lengths:\n", family.name)
+		for _, ones := range slices.Sorted(maps.Keys(family.Prefixes)) {
+			fmt.Fprintf(w, "  /%d\t%d\n", ones, family.Prefixes[ones])
+		}
+	}
+
+	examples(w, "Invalid networks", s.Invalid, limit, func(n string) string { return n })
+	examples(w, "Duplicate networks", s.Duplicates, limit, func(n string) string { return n })
+	examples(w, "Overlapping networks", s.Overlaps, limit, func(o dbreport.Overlap) string {
+		return o.Network + "\twithin " + o.Within
+	})
+	examples(w, "Dropped blocks", s.Dropped, limit, func(b dbgenerator.DroppedBlock) string {
+		network := b.Network
+		if network == "" {
+			network = "(empty row)"
+		}
+		if b.GeonameID != "" {
+			return fmt.Sprintf("%s\t%s %s", network, b.Reason, b.GeonameID)
+		}
+		return network + "\t" + b.Reason
+	})
+	return w.Flush()
+}
+
+// examples prints up to limit items under a title, and how many more there are
+func examples[T any](w io.Writer, title string, items []T, limit int, format func(T) string) {
+	if len(items) == 0 || limit <= 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, item := range items[:min(limit, len(items))] {
+		fmt.Fprintf(w, "  %s\n", format(item))
+	}
+	if len(items) > limit {
+		fmt.Fprintf(w, "  ... and %d more\n", len(items)-limit)
+	}
+}
+
+func init() {
+	inspectDBCmd.Flags().StringP("output", "o", lookupFormatTable, "Output format: table or json")
+	inspectDBCmd.Flags().Int("limit", 10, "Number of examples listed for every problem found, 0 for none")
+	rootCmd.AddCommand(inspectDBCmd)
+}
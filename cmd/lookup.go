@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"ip2country/internal/config"
+	stores "ip2country/internal/ip2country/store"
+	"ip2country/pkg/store"
+)
+
+const (
+	lookupFormatTable = "table"
+	lookupFormatJSON  = "json"
+	lookupFormatCSV   = "csv"
+)
+
+var lookupCmd = &cobra.Command{
+	Use:   "lookup [ip...]",
+	Short: "Look up IP addresses without running the service",
+	Long: "Look up IP addresses in the configured data store, or in the database file given with --db, and print where they are. " +
+		"Addresses are read from the arguments, or one per line from stdin when there are none. " +
+		"Exits with code 1 when an address is invalid or not found, and 2 when the data store cannot be opened.",
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		if format != lookupFormatTable && format != lookupFormatJSON && format != lookupFormatCSV {
+			fmt.Fprintf(os.Stderr, "Unknown output format %s, expected %s, %s or %s\n", format, lookupFormatTable, lookupFormatJSON, lookupFormatCSV)
+			os.Exit(2)
+		}
+		// Progress of the store is noise for a command line tool, only problems are reported
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+
+		s, err := openLookupStore(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer stores.Close(s)
+
+		var input io.Reader = strings.NewReader(strings.Join(args, "\n"))
+		if len(args) == 0 {
+			input = os.Stdin
+		}
+		misses, err := runLookup(s, input, os.Stdout, format)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if misses > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// openLookupStore opens the database file of --db, or the data store of the configuration
+func openLookupStore(cmd *cobra.Command) (store.Store, error) {
+	if path, _ := cmd.Flags().GetString("db"); path != "" {
+		return stores.OpenFileStore(path)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return openConfiguredStore(cmd, cfg)
+}
+
+// openConfiguredStore opens the data store of cfg and checks that it can serve lookups
+func openConfiguredStore(cmd *cobra.Command, cfg *config.Config) (store.Store, error) {
+	s, err := stores.NewStore(cfg, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if checker, ok := s.(store.Checker); ok {
+		if err := checker.Ready(cmd.Context()); err != nil {
+			return nil, fmt.Errorf("the %s data store cannot serve lookups: %w", stores.Name(s), err)
+		}
+	}
+	return s, nil
+}
+
+// lookupResult is the answer for one address, in every output format
+type lookupResult struct {
+	IP          string `json:"ip"`
+	Found       bool   `json:"found"`
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	City        string `json:"city,omitempty"`
+	Network     string `json:"network,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+var lookupColumns = []string{"ip", "found", "country", "country_code", "city", "network", "error"}
+
+func (r lookupResult) row() []string {
+	return []string{r.IP, fmt.Sprint(r.Found), r.Country, r.CountryCode, r.City, r.Network, r.Error}
+}
+
+// runLookup looks up every address of input, one per line, and writes the results to out in format.
+// Blank lines and lines starting with # are skipped. It returns how many addresses were invalid or not found.
+func runLookup(s store.Store, input io.Reader, out io.Writer, format string) (int, error) {
+	write, flush := lookupWriter(out, format)
+	misses := 0
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result := lookup(s, line)
+		if !result.Found {
+			misses++
+		}
+		if err := write(result); err != nil {
+			return misses, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return misses, fmt.Errorf("error reading addresses: %w", err)
+	}
+	return misses, flush()
+}
+
+func lookup(s store.Store, address string) lookupResult {
+	result := lookupResult{IP: address}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		result.Error = "invalid IP address"
+		return result
+	}
+	info, err := stores.Lookup(s, ip)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		result.Error = "not found"
+	case err != nil:
+		result.Error = err.Error()
+	default:
+		result.Found = true
+		result.Country = info.Country
+		result.CountryCode = info.CountryCode
+		result.City = info.City
+		result.Network = info.Subnet
+	}
+	return result
+}
+
+// lookupWriter returns a function writing a result to out in format, and one flushing what was written.
+// JSON results are written one object per line, so that a stream of addresses can be processed as it comes.
+func lookupWriter(out io.Writer, format string) (func(lookupResult) error, func() error) {
+	switch format {
+	case lookupFormatJSON:
+		encoder := json.NewEncoder(out)
+		return func(r lookupResult) error { return encoder.Encode(r) }, func() error { return nil }
+	case lookupFormatCSV:
+		w := csv.NewWriter(out)
+		header := false
+		return func(r lookupResult) error {
+				if !header {
+					header = true
+					if err := w.Write(lookupColumns); err != nil {
+						return err
+					}
+				}
+				return w.Write(r.row())
+			}, func() error {
+				w.Flush()
+				return w.Error()
+			}
+	default:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "IP\tCOUNTRY\tCODE\tCITY\tNETWORK")
+		return func(r lookupResult) error {
+			country := r.Country
+			if !r.Found {
+				country = "(" + r.Error + ")"
+			}
+			_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.IP, country, dash(r.CountryCode), dash(r.City), dash(r.Network))
+			return err
+		}, w.Flush
+	}
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+	lookupCmd.Flags().String("db", "", "Database file to look up in, a GeoLite2 zip or a geodata.dat file (default the configured data store)")
+	lookupCmd.Flags().StringP("output", "o", lookupFormatTable, "Output format: table, json (one object per line) or csv")
+	rootCmd.AddCommand(lookupCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"ip2country/pkg/store"
+)
+
+type mockStore struct{}
+
+func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	if ip.String() == "8.8.8.8" {
+		return &store.SubnetInfo{Subnet: "8.8.8.0/23", Country: "United States", CountryCode: "US", City: "Mountain View"}, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func TestRunLookup(t *testing.T) {
+	input := "8.8.8.8\n\n# resolvers\n1.0.0.1\nnot-an-ip\n"
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: lookupFormatTable,
+			expected: "IP         COUNTRY               CODE  CITY           NETWORK\n" +
+				"8.8.8.8    United States         US    Mountain View  8.8.8.0/23\n" +
+				"1.0.0.1    (not found)           -     -              -\n" +
+				"not-an-ip  (invalid IP address)  -     -              -\n",
+		},
+		{
+			format: lookupFormatJSON,
+			expected: `{"ip":"8.8.8.8","found":true,"country":"United States","country_code":"US","city":"Mountain View","network":"8.8.8.0/23"}` + "\n" +
+				`{"ip":"1.0.0.1","found":false,"error":"not found"}` + "\n" +
+				`{"ip":"not-an-ip","found":false,"error":"invalid IP address"}` + "\n",
+		},
+		{
+			format: lookupFormatCSV,
+			expected: "ip,found,country,country_code,city,network,error\n" +
+				"8.8.8.8,true,United States,US,Mountain View,8.8.8.0/23,\n" +
+				"1.0.0.1,false,,,,,not found\n" +
+				"not-an-ip,false,,,,,invalid IP address\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			misses, err := runLookup(&mockStore{}, strings.NewReader(input), &out, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if misses != 2 {
+				t.Errorf("Expected 2 misses, got %d", misses)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -14,10 +14,18 @@ var rootCmd = &cobra.Command{
 	Use:   "ip2country",
 	Short: "ip2country is a service that provides country information based on IP addresses",
 	Long:  `ip2country is a service that provides country information based on IP addresses.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("config")
+		profile, _ := cmd.Flags().GetString("profile")
+		config.SetFile(file)
+		config.SetProfile(profile)
+	},
 }
 
 func Execute() {
 	rootCmd.PersistentFlags().StringP("zippath", "p", "db/geolite2.zip", "Path to the zip file containing the database")
+	rootCmd.PersistentFlags().StringP("config", "c", "", "Path to the config file (default config.yaml in the working directory or its parent, or $"+config.EnvConfigFile+")")
+	rootCmd.PersistentFlags().String("profile", "", "Profile whose overlay, e.g. config.prod.yaml, is merged into the config file (default $"+config.EnvProfile+")")
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.CompletionOptions.DisableNoDescFlag = true
 	if err := rootCmd.Execute(); err != nil {
@@ -1,42 +1,118 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 
+	"ip2country/internal/auth"
 	"ip2country/internal/config"
+	"ip2country/internal/ip2country/dnsserver"
+	"ip2country/internal/ip2country/grpcserver"
 	"ip2country/internal/ip2country/handler"
 	"ip2country/internal/ip2country/store"
 	"ip2country/internal/logger"
+	"ip2country/internal/metrics"
 	"ip2country/internal/router"
+	"ip2country/internal/tracing"
 )
 
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the service",
-	Long:  "Run the service. Starts a server that listens to incoming requests",
-	Run: func(cmd *cobra.Command, args []string) {
+	Long:  "Run the service. Starts a server that listens to incoming requests until it receives SIGINT or SIGTERM",
+	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Running command: %s\n", cmd.Name())
 		localConfig, err := config.LoadConfig()
 		if err != nil {
-			return
+			return err
 		}
 		cfg = localConfig
-		logger.InitLogger(cfg)
-		slog.Info("Logger initialized")
+		if err := logger.InitLogger(cfg); err != nil {
+			return err
+		}
+		defer logger.Close()
+		slog.Info(fmt.Sprintf("Logger initialized at level %s", logger.Level()))
 		config.PrintConfigToLog(cfg, "")
+		shutdownTracing, err := tracing.Init(cmd.Context(), cfg)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				slog.Error(fmt.Sprintf("Error flushing traces: %v", err))
+			}
+		}()
 		slog.Info("Initializing data store")
 		storeImpl, err := store.NewStore(cfg, cmd)
 		if err != nil {
-			return
+			return err
 		}
+		// Deferred first so the store is closed only once every server has stopped using it
+		defer store.Close(storeImpl)
 		slog.Info("Data store initialized")
 		handler.SetStore(storeImpl)
+		metrics.SetStore(storeImpl)
+
+		if cfg.AuthEnabled {
+			authenticator, err := auth.NewAuthenticator(cfg)
+			if err != nil {
+				return fmt.Errorf("error initializing authentication: %w", err)
+			}
+			defer func() {
+				if err := authenticator.Close(); err != nil {
+					slog.Error(fmt.Sprintf("Error closing authentication: %v", err))
+				}
+			}()
+			router.SetAuthenticator(authenticator)
+			grpcserver.SetAuthenticator(authenticator)
+			slog.Info("API key authentication enabled")
+		}
+
+		config.Watch(cfg, func(previous, next *config.Config) {
+			// The level set on the admin endpoint stays until the file changes it
+			if level := logger.ConfiguredLevel(next); level != logger.ConfiguredLevel(previous) {
+				if err := logger.SetLevel(level); err != nil {
+					slog.Error(fmt.Sprintf("Error reloading the log level: %v", err))
+				}
+			}
+			router.Reload(next)
+			store.Reconfigure(storeImpl, next)
+		})
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		// The first server to fail stops the others, so the process exits instead of running half-served
+		servers, ctx := errgroup.WithContext(ctx)
+
+		if cfg.GrpcPort != 0 {
+			slog.Info(fmt.Sprintf("Starting gRPC server on %d", cfg.GrpcPort))
+			servers.Go(func() error {
+				return grpcserver.StartServer(ctx, cfg, storeImpl)
+			})
+		}
+
+		if cfg.DNSPort != 0 {
+			slog.Info(fmt.Sprintf("Starting DNS server on %d for zone %s", cfg.DNSPort, cfg.DNSZone))
+			servers.Go(func() error {
+				return dnsserver.StartServer(ctx, cfg, storeImpl)
+			})
+		}
+
+		slog.Info("Starting HTTP server")
+		servers.Go(func() error {
+			return router.StartServer(ctx, cfg)
+		})
 
-		slog.Info(fmt.Sprintf("Starting server on %d", cfg.Port))
-		router.StartServer(cfg)
+		err = servers.Wait()
+		slog.Info("Servers stopped")
+		return err
 	},
 }
 
@@ -0,0 +1,103 @@
+// Package auth Description: This package contains API key authentication and quotas for the ip2country service.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"ip2country/internal/config"
+	"ip2country/internal/middleware"
+)
+
+type contextKey string
+
+const keyNameKey contextKey = "api_key_name"
+
+// Authenticator checks API keys and enforces their quotas
+type Authenticator struct {
+	keys   *KeyStore
+	quotas *QuotaStore
+}
+
+// NewAuthenticator loads the keys from the configuration and the keys file, and the quota usage from the quota file.
+// The keys file is watched and reloaded when it changes.
+func NewAuthenticator(cfg *config.Config) (*Authenticator, error) {
+	keys, err := NewKeyStore(cfg.Auth.Keys, cfg.Auth.KeysFile)
+	if err != nil {
+		return nil, err
+	}
+	quotas, err := NewQuotaStore(cfg.Auth.QuotaFile)
+	if err != nil {
+		_ = keys.Close()
+		return nil, err
+	}
+	return &Authenticator{keys: keys, quotas: quotas}, nil
+}
+
+// Close stops watching the keys file and saves the quota usage
+func (a *Authenticator) Close() error {
+	keysErr := a.keys.Close()
+	if err := a.quotas.Close(); err != nil {
+		return err
+	}
+	return keysErr
+}
+
+// Middleware rejects requests without a known API key or client certificate with 401, and requests over their quota with 403
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		if err := a.quotas.Use(apiKey); err != nil {
+			slog.WarnContext(r.Context(), fmt.Sprintf("Authentication: %s: %v", apiKey.Name, err))
+			middleware.WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), keyNameKey, apiKey.Name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate identifies the client by its API key or, without one, by its verified client certificate.
+// It writes the 401 response itself when the client is unknown.
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request) (config.APIKey, bool) {
+	key := middleware.APIKey(r)
+	if key == "" {
+		if subject := middleware.ClientSubject(r); subject != "" {
+			if apiKey, ok := a.keys.LookupSubject(subject); ok {
+				return apiKey, true
+			}
+			slog.WarnContext(r.Context(), fmt.Sprintf("Authentication: unknown client certificate %s", subject))
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("ApiKey header=%q", middleware.APIKeyHeader))
+		middleware.WriteError(w, http.StatusUnauthorized, "API key is missing")
+		return config.APIKey{}, false
+	}
+
+	apiKey, ok := a.keys.Lookup(key)
+	if !ok {
+		slog.WarnContext(r.Context(), "Authentication: invalid API key")
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("ApiKey header=%q", middleware.APIKeyHeader))
+		middleware.WriteError(w, http.StatusUnauthorized, "Invalid API key")
+		return config.APIKey{}, false
+	}
+	return apiKey, true
+}
+
+// Known reports whether key is one of the API keys, without using its quota
+func (a *Authenticator) Known(key string) bool {
+	_, ok := a.keys.Lookup(key)
+	return ok
+}
+
+// KeyName returns the name of the API key that authenticated the request, if any
+func KeyName(ctx context.Context) string {
+	name, _ := ctx.Value(keyNameKey).(string)
+	return name
+}
@@ -0,0 +1,264 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sut "ip2country/internal/auth"
+	"ip2country/internal/config"
+	"ip2country/internal/middleware"
+)
+
+func newAuthenticator(t *testing.T, cfg *config.Config) *sut.Authenticator {
+	t.Helper()
+	a, err := sut.NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	return a
+}
+
+func serve(handler http.Handler, target, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", target, nil)
+	if key != "" {
+		req.Header.Set(middleware.APIKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMiddleware(t *testing.T) {
+	a := newAuthenticator(t, &config.Config{
+		Auth: config.AuthConfig{
+			Keys: []config.APIKey{{Key: "secret-1", Name: "team-a", DailyQuota: 2}},
+		},
+	})
+
+	var keyName string
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyName = sut.KeyName(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		target         string
+		key            string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Missing key",
+			target:         "/",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "API key is missing",
+		},
+		{
+			name:           "Invalid key",
+			target:         "/",
+			key:            "secret-2",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Invalid API key",
+		},
+		{
+			name:           "Valid header key",
+			target:         "/",
+			key:            "secret-1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Valid query key",
+			target:         "/?api_key=secret-1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Daily quota exceeded",
+			target:         "/",
+			key:            "secret-1",
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "daily quota exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(handler, tt.target, tt.key)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedError == "" {
+				if keyName != "team-a" {
+					t.Errorf("handler saw wrong key name: got %v want %v", keyName, "team-a")
+				}
+				return
+			}
+			var resp middleware.ErrorResponse
+			_ = json.NewDecoder(rr.Body).Decode(&resp)
+			if resp.Error != tt.expectedError {
+				t.Errorf("handler returned unexpected error: got %v want %v", resp.Error, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestQuotaPersistence(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			QuotaFile: filepath.Join(dir, "quotas.json"),
+			Keys:      []config.APIKey{{Key: "secret-1", Name: "team-a", MonthlyQuota: 2}},
+		},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	a, err := sut.NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := serve(a.Middleware(ok), "/", "secret-1").Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Usage survives a restart
+	a = newAuthenticator(t, cfg)
+	handler := a.Middleware(ok)
+	if status := serve(handler, "/", "secret-1").Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if status := serve(handler, "/", "secret-1").Code; status != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+	}
+}
+
+func TestKeysFileReload(t *testing.T) {
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "keys.yaml")
+	if err := os.WriteFile(keysFile, []byte("keys:\n  - key: secret-1\n    name: team-a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newAuthenticator(t, &config.Config{Auth: config.AuthConfig{KeysFile: keysFile}})
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if status := serve(handler, "/", "secret-1").Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	// Rotate the key by replacing the file, as secret mounts do
+	tmp := filepath.Join(dir, "keys.yaml.new")
+	if err := os.WriteFile(tmp, []byte("keys:\n  - key: secret-2\n    name: team-a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, keysFile); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for serve(handler, "/", "secret-2").Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the keys file to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := serve(handler, "/", "secret-1").Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for rotated key: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestKeysFileReloadSymlinkSwap(t *testing.T) {
+	// Lay the keys out as a Kubernetes secret mount: keys.yaml -> ..data/keys.yaml, ..data -> a timestamped directory
+	dir := t.TempDir()
+	version := func(name, key string) {
+		t.Helper()
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		content := []byte("keys:\n  - key: " + key + "\n    name: team-a\n")
+		if err := os.WriteFile(filepath.Join(dir, name, "keys.yaml"), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version("..v1", "secret-1")
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	keysFile := filepath.Join(dir, "keys.yaml")
+	if err := os.Symlink(filepath.Join("..data", "keys.yaml"), keysFile); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newAuthenticator(t, &config.Config{Auth: config.AuthConfig{KeysFile: keysFile}})
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if status := serve(handler, "/", "secret-1").Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	// Rotate the secret the way the kubelet does, swapping the ..data symlink atomically
+	version("..v2", "secret-2")
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for serve(handler, "/", "secret-2").Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the keys file to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := serve(handler, "/", "secret-1").Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for rotated key: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestMiddlewareClientCertificate(t *testing.T) {
+	a := newAuthenticator(t, &config.Config{
+		Auth: config.AuthConfig{
+			Keys: []config.APIKey{{Subject: "CN=team-a,O=Example", Name: "team-a", DailyQuota: 1}},
+		},
+	})
+
+	var keyName string
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyName = sut.KeyName(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(commonName string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName, Organization: []string{"Example"}}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request("team-b"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown certificate to be rejected with %v, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := request("team-a"); rr.Code != http.StatusOK {
+		t.Errorf("Expected known certificate to be accepted, got %v", rr.Code)
+	}
+	if keyName != "team-a" {
+		t.Errorf("Expected key name team-a, got %s", keyName)
+	}
+	if rr := request("team-a"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected quota to apply to certificates, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyMetadata carries the caller's API key in gRPC calls, the X-API-Key header of HTTP
+const APIKeyMetadata = "x-api-key"
+
+// healthServicePrefix starts the methods of the standard health service, which probes call without a key
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// UnaryInterceptor rejects calls without a known API key with Unauthenticated, and calls over their quota with
+// PermissionDenied, like Middleware does for HTTP
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.authenticateRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authenticates streaming calls like UnaryInterceptor, a quota unit is used per call
+func (a *Authenticator) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+		return handler(srv, ss)
+	}
+	ctx, err := a.authenticateRPC(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticateRPC identifies the caller by the API key of the call metadata and uses its quota
+func (a *Authenticator) authenticateRPC(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(APIKeyMetadata)
+	if len(values) == 0 || values[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "API key is missing")
+	}
+	apiKey, ok := a.keys.Lookup(values[0])
+	if !ok {
+		slog.WarnContext(ctx, "Authentication: invalid API key")
+		return nil, status.Error(codes.Unauthenticated, "Invalid API key")
+	}
+	if err := a.quotas.Use(apiKey); err != nil {
+		slog.WarnContext(ctx, fmt.Sprintf("Authentication: %s: %v", apiKey.Name, err))
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return context.WithValue(ctx, keyNameKey, apiKey.Name), nil
+}
+
+// authenticatedStream is a server stream whose context carries the name of the caller's API key
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
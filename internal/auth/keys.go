@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"ip2country/internal/config"
+)
+
+// KeyStore holds the known API keys, merging the keys of the configuration with those of an optional keys file
+type KeyStore struct {
+	static  []config.APIKey
+	path    string
+	keys    atomic.Pointer[keySet]
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// keySet indexes keys by the hash of their secret and by their client certificate subject
+type keySet struct {
+	bySecret  map[[sha256.Size]byte]config.APIKey
+	bySubject map[string]config.APIKey
+}
+
+type keysFile struct {
+	Keys []config.APIKey `yaml:"keys"`
+}
+
+// NewKeyStore loads the keys and, when path is set, starts watching the keys file for changes
+func NewKeyStore(static []config.APIKey, path string) (*KeyStore, error) {
+	ks := &KeyStore{static: static, path: path, done: make(chan struct{})}
+	if err := ks.reload(); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return ks, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch keys file: %w", err)
+	}
+	// Watch the directory, editors and secret mounts replace the file rather than writing it in place
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("failed to watch keys file %s: %w", path, err)
+	}
+	ks.watcher = watcher
+	ks.wg.Add(1)
+	go ks.watch()
+	return ks, nil
+}
+
+// Lookup returns the key matching the given secret
+func (ks *KeyStore) Lookup(key string) (config.APIKey, bool) {
+	apiKey, ok := ks.keys.Load().bySecret[sha256.Sum256([]byte(key))]
+	// Hashing keeps the map lookup from leaking how much of a key matched, compare the secret itself in constant time
+	if !ok || subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) != 1 {
+		return config.APIKey{}, false
+	}
+	return apiKey, true
+}
+
+// LookupSubject returns the key of the client whose verified certificate has the given subject
+func (ks *KeyStore) LookupSubject(subject string) (config.APIKey, bool) {
+	apiKey, ok := ks.keys.Load().bySubject[subject]
+	return apiKey, ok
+}
+
+func (ks *KeyStore) Close() error {
+	if ks.watcher == nil {
+		return nil
+	}
+	close(ks.done)
+	err := ks.watcher.Close()
+	ks.wg.Wait()
+	return err
+}
+
+func (ks *KeyStore) watch() {
+	defer ks.wg.Done()
+	target := filepath.Clean(ks.path)
+	for {
+		select {
+		case <-ks.done:
+			return
+		case event, ok := <-ks.watcher.Events:
+			if !ok {
+				return
+			}
+			// Kubernetes secret mounts swap a "..data" symlink instead of touching the file itself
+			if filepath.Clean(event.Name) != target && filepath.Base(event.Name) != "..data" {
+				continue
+			}
+			if !event.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename) {
+				continue
+			}
+			if err := ks.reload(); err != nil {
+				slog.Error(fmt.Sprintf("Error reloading API keys, keeping the previous keys: %v", err))
+				continue
+			}
+			slog.Info(fmt.Sprintf("Reloaded API keys from %s", ks.path))
+		case err, ok := <-ks.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error(fmt.Sprintf("Error watching API keys file: %v", err))
+		}
+	}
+}
+
+func (ks *KeyStore) reload() error {
+	all := append([]config.APIKey{}, ks.static...)
+	if ks.path != "" {
+		fileKeys, err := loadKeysFile(ks.path)
+		if err != nil {
+			return err
+		}
+		all = append(all, fileKeys...)
+	}
+
+	keys := keySet{
+		bySecret:  make(map[[sha256.Size]byte]config.APIKey, len(all)),
+		bySubject: make(map[string]config.APIKey),
+	}
+	for _, apiKey := range all {
+		if apiKey.Key == "" && apiKey.Subject == "" {
+			return errors.New("API key with neither a key nor a subject")
+		}
+		if apiKey.Key == "" {
+			if apiKey.Name == "" {
+				apiKey.Name = apiKey.Subject
+			}
+			keys.bySubject[apiKey.Subject] = apiKey
+			continue
+		}
+		sum := sha256.Sum256([]byte(apiKey.Key))
+		if apiKey.Name == "" {
+			// Quotas are tracked by name, never by the secret itself
+			apiKey.Name = hex.EncodeToString(sum[:4])
+		}
+		keys.bySecret[sum] = apiKey
+		if apiKey.Subject != "" {
+			keys.bySubject[apiKey.Subject] = apiKey
+		}
+	}
+	ks.keys.Store(&keys)
+	return nil
+}
+
+func loadKeysFile(path string) ([]config.APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file %s: %w", path, err)
+	}
+	var file keysFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keys file %s: %w", path, err)
+	}
+	return file.Keys, nil
+}
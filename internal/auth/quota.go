@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"ip2country/internal/config"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+
+	// quotaSaveInterval is how often usage is written to the quota file
+	quotaSaveInterval = 10 * time.Second
+)
+
+var (
+	ErrDailyQuotaExceeded   = errors.New("daily quota exceeded")
+	ErrMonthlyQuotaExceeded = errors.New("monthly quota exceeded")
+)
+
+// usage counts the requests of a key in the current UTC day and month
+type usage struct {
+	Day     string `json:"day"`
+	Daily   int    `json:"daily"`
+	Month   string `json:"month"`
+	Monthly int    `json:"monthly"`
+}
+
+// QuotaStore counts requests per key name, persisting the counts to a local file so they survive restarts
+type QuotaStore struct {
+	path  string
+	now   func() time.Time
+	mu    sync.Mutex
+	usage map[string]*usage
+	dirty bool
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewQuotaStore loads the usage saved in path. Without a path, usage is only kept in memory.
+func NewQuotaStore(path string) (*QuotaStore, error) {
+	qs := &QuotaStore{
+		path:  path,
+		now:   time.Now,
+		usage: make(map[string]*usage),
+		done:  make(chan struct{}),
+	}
+	if path == "" {
+		return qs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read quota file %s: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &qs.usage); err != nil {
+			return nil, fmt.Errorf("failed to parse quota file %s: %w", path, err)
+		}
+	}
+
+	qs.wg.Add(1)
+	go qs.saveLoop()
+	return qs, nil
+}
+
+// Use counts a request of the key, unless it would exceed one of its quotas
+func (qs *QuotaStore) Use(apiKey config.APIKey) error {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	now := qs.now().UTC()
+	day, month := now.Format(dayLayout), now.Format(monthLayout)
+	u, ok := qs.usage[apiKey.Name]
+	if !ok {
+		u = &usage{}
+		qs.usage[apiKey.Name] = u
+	}
+	if u.Day != day {
+		u.Day, u.Daily = day, 0
+	}
+	if u.Month != month {
+		u.Month, u.Monthly = month, 0
+	}
+
+	if apiKey.DailyQuota > 0 && u.Daily >= apiKey.DailyQuota {
+		return ErrDailyQuotaExceeded
+	}
+	if apiKey.MonthlyQuota > 0 && u.Monthly >= apiKey.MonthlyQuota {
+		return ErrMonthlyQuotaExceeded
+	}
+	u.Daily++
+	u.Monthly++
+	qs.dirty = true
+	return nil
+}
+
+// Close stops the periodic saving and saves the latest usage
+func (qs *QuotaStore) Close() error {
+	if qs.path == "" {
+		return nil
+	}
+	close(qs.done)
+	qs.wg.Wait()
+	return qs.Save()
+}
+
+// Save writes the usage to the quota file if it changed since the last save
+func (qs *QuotaStore) Save() error {
+	qs.mu.Lock()
+	if !qs.dirty || qs.path == "" {
+		qs.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(qs.usage)
+	qs.dirty = false
+	qs.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(qs.path, data)
+	}
+	if err != nil {
+		qs.mu.Lock()
+		qs.dirty = true
+		qs.mu.Unlock()
+		return fmt.Errorf("failed to save quota file %s: %w", qs.path, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes next to the file and renames, so a crash never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (qs *QuotaStore) saveLoop() {
+	defer qs.wg.Done()
+	ticker := time.NewTicker(quotaSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-qs.done:
+			return
+		case <-ticker.C:
+			if err := qs.Save(); err != nil {
+				slog.Error(fmt.Sprintf("Error saving quota usage: %v", err))
+			}
+		}
+	}
+}
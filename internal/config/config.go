@@ -4,8 +4,11 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -14,51 +17,228 @@ import (
 type DatabaseType string
 
 const (
-	defaultLogLevel                     = "info"
 	defaultServiceName                  = "ip2country"
 	defaultServiceVersion               = "0.0.1"
 	defaultActiveDataStore              = Local
-	logLevel                            = "LOG_LEVEL"
-	serviceName                         = "SERVICE_NAME"
-	serviceVersion                      = "SERVICE_VERSION"
+	defaultDNSZone                      = "origin.ip2country."
+	logLevel                            = "LOGGER.LEVEL"
+	logFormat                           = "LOGGER.FORMAT"
+	logOutput                           = "LOGGER.OUTPUT"
+	logFileMaxSize                      = "LOGGER.FILE.MAXSIZEMB"
+	logFileMaxAge                       = "LOGGER.FILE.MAXAGEDAYS"
+	serviceName                         = "LOGGER.SERVICENAME"
+	serviceVersion                      = "LOGGER.SERVICEVERSION"
 	activeDataStore                     = "ACTIVE_DATA_STORE"
-	isDebug                             = "IP2COUNTRY_DEBUG"
+	isDebug                             = "ISDEBUG"
 	port                                = "PORT"
 	rateLimit                           = "RATE_LIMIT"
 	burstLimit                          = "BURST_LIMIT"
+	rateLimitKey                        = "RATE_LIMIT_KEY"
+	rateLimitHeader                     = "RATE_LIMIT_HEADER"
+	rateLimitBackend                    = "RATE_LIMIT_BACKEND"
+	redisAddr                           = "REDIS_ADDR"
+	redisPassword                       = "REDIS_PASSWORD"
+	redisDB                             = "REDIS_DB"
+	trustedProxies                      = "TRUSTED_PROXIES"
+	authEnabled                         = "AUTH_ENABLED"
+	tlsClientAuth                       = "TLS.CLIENTAUTH"
+	tracingExporter                     = "TRACING.EXPORTER"
+	tracingEndpoint                     = "TRACING.ENDPOINT"
+	tracingSampleRatio                  = "TRACING.SAMPLERATIO"
+	grpcPort                            = "GRPC_PORT"
+	dnsPort                             = "DNS_PORT"
+	dnsZone                             = "DNS_ZONE"
+	readTimeout                         = "READ_TIMEOUT"
+	readHeaderTimeout                   = "READ_HEADER_TIMEOUT"
+	writeTimeout                        = "WRITE_TIMEOUT"
+	idleTimeout                         = "IDLE_TIMEOUT"
+	maxHeaderBytes                      = "MAX_HEADER_BYTES"
+	shutdownTimeout                     = "SHUTDOWN_TIMEOUT"
+	accessLogFields                     = "ACCESS_LOG_FIELDS"
 	configLogPrefix                     = "[Config]"
+	RateLimitByIP                       = "ip"
+	RateLimitByAPIKey                   = "api_key"
+	RateLimitByHeader                   = "header"
+	RateLimitBackendMemory              = "memory"
+	RateLimitBackendRedis               = "redis"
+	RateLimitByClientCert               = "client_cert"
+	TLSClientAuthRequire                = "require"
+	TLSClientAuthOptional               = "optional"
+	ListenerTCP                         = "tcp"
+	ListenerUnix                        = "unix"
+	ListenerSystemd                     = "systemd"
+	ProfilePublic                       = "public"
+	ProfileInternal                     = "internal"
+	TracingExporterNone                 = "none"
+	TracingExporterStdout               = "stdout"
+	TracingExporterOTLP                 = "otlp"
+	LogFormatJSON                       = "json"
+	LogFormatText                       = "text"
+	LogFormatTint                       = "tint"
+	LogOutputStdout                     = "stdout"
+	LogOutputStderr                     = "stderr"
+	LogOutputFile                       = "file"
 	Local                  DatabaseType = "local"
 	API                    DatabaseType = "api"
 	Relational             DatabaseType = "some_relational_db"
 )
 
+// DefaultAccessLogFields are the fields of the access log entries when ACCESS_LOG_FIELDS is not set
+var DefaultAccessLogFields = []string{"method", "path", "status", "duration", "bytes", "client_ip", "user_agent"}
+
 type Config struct {
-	DB              []dbConfig
-	Logger          loggerConfig
-	ActiveDataStore DatabaseType `mapstructure:"ACTIVE_DATA_STORE"`
-	RateLimit       int          `mapstructure:"RATE_LIMIT"`
-	BurstLimit      int          `mapstructure:"BURST_LIMIT"`
-	Port            int
-	IsDebug         bool
+	DB                 []DBConfig
+	Logger             LoggerConfig
+	ActiveDataStore    DatabaseType  `mapstructure:"ACTIVE_DATA_STORE"`
+	RateLimit          int           `mapstructure:"RATE_LIMIT"`
+	BurstLimit         int           `mapstructure:"BURST_LIMIT"`
+	RateLimitKey       string        `mapstructure:"RATE_LIMIT_KEY"`
+	RateLimitHeader    string        `mapstructure:"RATE_LIMIT_HEADER"`
+	RateLimitBackend   string        `mapstructure:"RATE_LIMIT_BACKEND"`
+	RedisAddr          string        `mapstructure:"REDIS_ADDR"`
+	RedisPassword      string        `mapstructure:"REDIS_PASSWORD" secret:"true"`
+	RedisDB            int           `mapstructure:"REDIS_DB"`
+	TrustedProxies     []string      `mapstructure:"TRUSTED_PROXIES"`
+	GrpcPort           int           `mapstructure:"GRPC_PORT"`
+	DNSPort            int           `mapstructure:"DNS_PORT"`
+	DNSZone            string        `mapstructure:"DNS_ZONE"`
+	AuthEnabled        bool          `mapstructure:"AUTH_ENABLED"`
+	ReadTimeout        time.Duration `mapstructure:"READ_TIMEOUT"`
+	ReadHeaderTimeout  time.Duration `mapstructure:"READ_HEADER_TIMEOUT"`
+	WriteTimeout       time.Duration `mapstructure:"WRITE_TIMEOUT"`
+	IdleTimeout        time.Duration `mapstructure:"IDLE_TIMEOUT"`
+	MaxHeaderBytes     int           `mapstructure:"MAX_HEADER_BYTES"`
+	ShutdownTimeout    time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	AccessLogFields    []string      `mapstructure:"ACCESS_LOG_FIELDS"`
+	Auth               AuthConfig
+	TLS                TLSConfig
+	Tracing            TracingConfig
+	RateLimitOverrides []RateLimitOverride
+	Listeners          []ListenerConfig
+	Port               int
+	IsDebug            bool
+}
+
+// RateLimitOverride replaces RATE_LIMIT and BURST_LIMIT for a single client key. Kind is the kind of the key, one
+// of the RATE_LIMIT_KEY values, and defaults to RATE_LIMIT_KEY.
+type RateLimitOverride struct {
+	Key   string `secret:"true"`
+	Rate  int
+	Burst int
+	Kind  string
+}
+
+// ListenerConfig is an address the HTTP API is served on. Address is a host:port for tcp, a socket path for unix and,
+// for systemd, the name of a socket passed by socket activation (empty takes the sockets in order).
+// Mode sets the permissions of a unix socket, e.g. "0660". Profile selects the middleware: public listeners are rate
+// limited and authenticated, internal ones are not.
+type ListenerConfig struct {
+	Network string
+	Address string
+	Mode    string
+	Profile string
+}
+
+// AuthConfig holds the API keys and where their keys and quota usage are stored
+type AuthConfig struct {
+	KeysFile  string
+	QuotaFile string
+	Keys      []APIKey
+}
+
+// TLSConfig enables HTTPS when a certificate is set, and client certificate verification when a CA bundle is set.
+// HealthCheckCertFile and HealthCheckKeyFile are the client certificate the healthcheck command presents with mutual TLS.
+type TLSConfig struct {
+	CertFile            string
+	KeyFile             string
+	ClientCAFile        string
+	ClientAuth          string
+	HealthCheckCertFile string
+	HealthCheckKeyFile  string
+}
+
+// TracingConfig selects where OpenTelemetry spans are exported: nowhere (none), to stdout, or to an OTLP gRPC collector
+type TracingConfig struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+}
+
+// APIKey is a client allowed to call the service, identified by its key or its client certificate subject.
+// A quota of 0 means unlimited.
+type APIKey struct {
+	Key          string `yaml:"key" secret:"true"`
+	Subject      string `yaml:"subject"`
+	Name         string `yaml:"name"`
+	DailyQuota   int    `yaml:"dailyQuota"`
+	MonthlyQuota int    `yaml:"monthlyQuota"`
 }
 
-type dbConfig struct {
-	Host string
+// DBConfig is a data source. Host is the path of a local database or the URL of an API, whose query values, such as
+// an API key, are hidden in logs.
+type DBConfig struct {
+	Host string `secret:"url"`
 	Name DatabaseType
 }
 
-type loggerConfig struct {
+// LoggerConfig selects the level, format and destination of logs. Without a format, logs are JSON, or tint when
+// debugging.
+type LoggerConfig struct {
 	Level          string
+	Format         string
+	Output         string
+	File           LogFileConfig
 	ServiceName    string
 	ServiceVersion string
 }
 
+// LogFileConfig is the log file written when the output is "file". It is rotated once it reaches MaxSizeMB, and
+// rotated files are removed after MaxAgeDays or beyond MaxBackups files. 0 keeps rotated files forever.
+type LogFileConfig struct {
+	Path       string
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+	Compress   bool
+}
+
+var (
+	configFile string
+	profile    string
+)
+
+// SetFile makes LoadConfig read the config file at path, instead of config.yaml in the working directory or its parent
+func SetFile(path string) {
+	configFile = path
+}
+
+// SetProfile makes LoadConfig merge the overlay of the profile, e.g. config.prod.yaml for "prod", into the config file
+func SetProfile(name string) {
+	profile = name
+}
+
 func LoadConfig() (*Config, error) {
+	file, name := configFile, profile
+	if file == "" {
+		file = os.Getenv(EnvConfigFile)
+	}
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
 	viper.SetConfigName("config") // name of config file (without extension)
 	viper.SetConfigType("yaml")   // or viper.SetConfigType("YAML")
 	viper.AddConfigPath(".")      // optionally look for config in the working directory
 	viper.AddConfigPath("..")
-	viper.SetDefault(logLevel, defaultLogLevel)
+	// Set last, setting the name above forgets the file
+	if file != "" {
+		viper.SetConfigFile(file)
+	}
+	// logger.level has no default, without one the level depends on isDebug
+	viper.SetDefault(logFormat, "")
+	viper.SetDefault(logOutput, LogOutputStdout)
+	viper.SetDefault(logFileMaxSize, 100)
+	viper.SetDefault(logFileMaxAge, 30)
 	viper.SetDefault(serviceName, defaultServiceName)
 	viper.SetDefault(serviceVersion, defaultServiceVersion)
 	viper.SetDefault(activeDataStore, string(defaultActiveDataStore))
@@ -66,31 +246,66 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault(isDebug, false)
 	viper.SetDefault(rateLimit, 1)
 	viper.SetDefault(burstLimit, 5)
+	viper.SetDefault(rateLimitKey, RateLimitByIP)
+	viper.SetDefault(rateLimitHeader, "")
+	viper.SetDefault(rateLimitBackend, RateLimitBackendMemory)
+	viper.SetDefault(redisAddr, "localhost:6379")
+	viper.SetDefault(redisPassword, "")
+	viper.SetDefault(redisDB, 0)
+	viper.SetDefault(trustedProxies, []string{})
+	viper.SetDefault(authEnabled, false)
+	viper.SetDefault(tlsClientAuth, TLSClientAuthRequire)
+	viper.SetDefault(tracingExporter, TracingExporterNone)
+	viper.SetDefault(tracingEndpoint, "localhost:4317")
+	viper.SetDefault(tracingSampleRatio, 1.0)
+	viper.SetDefault(grpcPort, 0)
+	viper.SetDefault(dnsPort, 0)
+	viper.SetDefault(dnsZone, defaultDNSZone)
+	viper.SetDefault(readTimeout, 5*time.Second)
+	viper.SetDefault(readHeaderTimeout, 2*time.Second)
+	viper.SetDefault(writeTimeout, 10*time.Second)
+	viper.SetDefault(idleTimeout, 60*time.Second)
+	viper.SetDefault(maxHeaderBytes, 1<<20)
+	viper.SetDefault(shutdownTimeout, 15*time.Second)
+	viper.SetDefault(accessLogFields, DefaultAccessLogFields)
 	//viper.AutomaticEnv()
 
 	// If a config file is found, read it in
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
+	activeProfile = name
+	if err := mergeProfile(); err != nil {
+		return nil, err
+	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// Environment variables are read with the IP2COUNTRY_ prefix, so generic names such as PORT cannot collide
+	if err := applyEnv(os.Environ()); err != nil {
+		return nil, fmt.Errorf("error reading environment: %w", err)
+	}
 	var cfg Config
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("unable to decode into struct: %w", err)
 	}
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, fmt.Errorf("error reading secrets:\n%w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s:\n%w", Source(), err)
+	}
 
 	return &cfg, nil
 
 	//return &Config{
 	//	ActiveDataStore: DatabaseType(viper.GetString(activeDataStore)),
 	//	IsDebug:         viper.GetBool(isDebug),
-	//	DB: []dbConfig{
+	//	DB: []DBConfig{
 	//		{
 	//			Host: "db/geolite2.zip",
 	//			Name: defaultActiveDataStore,
 	//		},
 	//	},
-	//	Logger: loggerConfig{
+	//	Logger: LoggerConfig{
 	//		Level:          viper.GetString(logLevel),
 	//		ServiceName:    viper.GetString(serviceName),
 	//		ServiceVersion: viper.GetString(serviceVersion),
@@ -98,6 +313,43 @@ func LoadConfig() (*Config, error) {
 	//}, nil
 }
 
+// activeProfile is the profile whose overlay was merged by LoadConfig, and is merged again on reload
+var activeProfile string
+
+// ProfileFile returns the overlay of a profile, next to the config file: config.prod.yaml for config.yaml and "prod"
+func ProfileFile(name string) string {
+	file := viper.ConfigFileUsed()
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + name + ext
+}
+
+// mergeProfile merges the overlay of the active profile into the config file read by viper. Maps are merged
+// key by key, while lists and other values of the overlay replace those of the config file.
+func mergeProfile() error {
+	if activeProfile == "" {
+		return nil
+	}
+	overlay, err := os.Open(ProfileFile(activeProfile))
+	if err != nil {
+		return fmt.Errorf("error reading the %s profile: %w", activeProfile, err)
+	}
+	defer overlay.Close()
+	if err := viper.MergeConfig(overlay); err != nil {
+		return fmt.Errorf("error reading the %s profile: %w", activeProfile, err)
+	}
+	return nil
+}
+
+// Source describes where the configuration was loaded from, the config file along with the overlay of its profile
+func Source() string {
+	if activeProfile == "" {
+		return viper.ConfigFileUsed()
+	}
+	return fmt.Sprintf("%s with %s", viper.ConfigFileUsed(), ProfileFile(activeProfile))
+}
+
+// PrintConfigToLog logs every setting of cfg. Secrets are redacted according to the secret tag of their field,
+// see redact.
 func PrintConfigToLog(cfg interface{}, prefix string) {
 	fields := reflect.TypeOf(cfg)
 	values := reflect.ValueOf(cfg)
@@ -108,18 +360,18 @@ func PrintConfigToLog(cfg interface{}, prefix string) {
 		filKind = fields.Kind()
 	}
 	if filKind != reflect.Struct {
-		printSingle(values, prefix, "")
+		printSingle(values, strings.TrimSuffix(prefix, "."), "", "")
 		return
 	}
 	num := fields.NumField()
 	for i := range num {
 		value := values.Field(i)
 		field := fields.Field(i)
-		printSingle(value, prefix, field.Name)
+		printSingle(value, prefix, field.Name, field.Tag.Get("secret"))
 	}
 }
 
-func printSingle(value reflect.Value, prefix, fieldName string) {
+func printSingle(value reflect.Value, prefix, fieldName, secret string) {
 	valKind := value.Kind()
 	switch valKind {
 	case reflect.Ptr:
@@ -130,13 +382,17 @@ func printSingle(value reflect.Value, prefix, fieldName string) {
 		}
 	case reflect.Slice:
 		for i := range value.Len() {
-			PrintConfigToLog(value.Index(i).Interface(), sprintfConfigSliceElement(prefix, fieldName, i))
+			element := sprintfConfigSliceElement(prefix, fieldName, i)
+			if value.Index(i).Kind() == reflect.Struct {
+				PrintConfigToLog(value.Index(i).Interface(), element)
+			} else {
+				printSingle(value.Index(i), strings.TrimSuffix(element, "."), "", secret)
+			}
 		}
 	case reflect.Struct:
 		PrintConfigToLog(value.Interface(), fieldName+".")
 	case reflect.String:
-		value := fmt.Sprint(value.Interface())
-		// value = sanitizeString(fieldName, value) // Create a sanitizer if and when we get values that need hiding
+		value := redact(fmt.Sprint(value.Interface()), secret)
 		slog.Info(fmt.Sprintf("%s[%s] = [%s]", configLogPrefix, prefix+fieldName, value))
 	case reflect.Bool:
 		slog.Info(fmt.Sprintf("%s[%s] = [%s]", configLogPrefix, prefix+fieldName, strconv.FormatBool(value.Interface().(bool))))
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// EnvPrefix starts the name of every environment variable read by the service
+	EnvPrefix = "IP2COUNTRY_"
+	// EnvConfigFile and EnvProfile select the config file and profile when the flags are not set
+	EnvConfigFile = EnvPrefix + "CONFIG"
+	EnvProfile    = EnvPrefix + "PROFILE"
+)
+
+// applyEnv overrides settings with the IP2COUNTRY_ environment variables in environ. Variables are named after the
+// path of the setting in upper case joined by underscores, with the index of list entries, e.g.
+// IP2COUNTRY_RATE_LIMIT, IP2COUNTRY_LOGGER_LEVEL or IP2COUNTRY_DB_0_HOST. Variables matching no setting are ignored.
+// Overrides take precedence over the config file, also when it is reloaded. Service links injected by Kubernetes
+// for a service named ip2country are skipped.
+func applyEnv(environ []string) error {
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || name == EnvConfigFile || name == EnvProfile {
+			continue
+		}
+		if isServiceLink(name, value) {
+			slog.Warn(fmt.Sprintf("%s Ignoring %s=%s, a Kubernetes service link rather than a setting", configLogPrefix, name, value))
+			continue
+		}
+		path, ok := envPath(reflect.TypeOf(Config{}), strings.Split(strings.TrimPrefix(name, EnvPrefix), "_"))
+		if !ok {
+			continue
+		}
+
+		// Entries of a list are set by replacing the whole list, other settings by their own key
+		var keys []string
+		for len(path) > 0 {
+			key, ok := path[0].(string)
+			if !ok {
+				break
+			}
+			keys, path = append(keys, key), path[1:]
+		}
+		key := strings.Join(keys, ".")
+		if len(path) == 0 {
+			viper.Set(key, value)
+			continue
+		}
+		list, err := setPath(viper.Get(key), path, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		viper.Set(key, list)
+	}
+	return nil
+}
+
+// isServiceLink reports whether a variable was injected by Kubernetes for a service, such as IP2COUNTRY_PORT=tcp://10.0.0.1:8080
+// or IP2COUNTRY_PORT_8080_TCP for a service named ip2country, which would otherwise override port
+func isServiceLink(name, value string) bool {
+	if !strings.Contains(name, "_PORT") {
+		return false
+	}
+	for _, scheme := range []string{"tcp://", "udp://", "sctp://"} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// envPath resolves the upper case parts of a variable name to the keys and list indexes of a setting of type t.
+// Keys may contain underscores themselves, e.g. RATE_LIMIT_KEY, so every field matching a prefix is tried.
+func envPath(t reflect.Type, parts []string) ([]any, bool) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return envPath(t.Elem(), parts)
+	case reflect.Struct:
+		if len(parts) == 0 {
+			return nil, false
+		}
+		for i := range t.NumField() {
+			key := fieldKey(t.Field(i))
+			keyParts := strings.Split(strings.ToUpper(key), "_")
+			if len(keyParts) > len(parts) || !slices.Equal(keyParts, parts[:len(keyParts)]) {
+				continue
+			}
+			if rest, ok := envPath(t.Field(i).Type, parts[len(keyParts):]); ok {
+				return append([]any{strings.ToLower(key)}, rest...), true
+			}
+		}
+		return nil, false
+	case reflect.Slice:
+		if len(parts) == 0 {
+			return nil, true
+		}
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 {
+			return nil, false
+		}
+		rest, ok := envPath(t.Elem(), parts[1:])
+		if !ok {
+			return nil, false
+		}
+		return append([]any{index}, rest...), true
+	default:
+		return nil, len(parts) == 0
+	}
+}
+
+// fieldKey is the key of a field in the config file, its mapstructure name or the field name
+func fieldKey(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// setPath returns a copy of node, a value of viper settings, with value set at path. Missing maps are created, and
+// lists grow by one entry when the index is their length.
+func setPath(node any, path []any, value string) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch key := path[0].(type) {
+	case string:
+		m := make(map[string]any)
+		if existing, ok := node.(map[string]any); ok {
+			maps.Copy(m, existing)
+		}
+		// Keys of list entries keep the case of the config file
+		for existing := range m {
+			if strings.EqualFold(existing, key) {
+				key = existing
+				break
+			}
+		}
+		child, err := setPath(m[key], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = child
+		return m, nil
+	default:
+		index := key.(int)
+		var list []any
+		if v := reflect.ValueOf(node); v.Kind() == reflect.Slice {
+			for i := range v.Len() {
+				list = append(list, v.Index(i).Interface())
+			}
+		}
+		if index > len(list) {
+			return nil, fmt.Errorf("index %d is out of range, the list has %d entries", index, len(list))
+		}
+		if index == len(list) {
+			list = append(list, nil)
+		}
+		child, err := setPath(list[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[index] = child
+		return list, nil
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const testConfig = `
+db:
+  - host: "db/geolite2.zip"
+    name: "local"
+  - host: "https://api.example.com/geo.json?host"
+    name: "api"
+logger:
+  level: "info"
+ACTIVE_DATA_STORE: "local"
+RATE_LIMIT: 1
+BURST_LIMIT: 5
+TRUSTED_PROXIES: ["10.0.0.0/8"]
+port: 8080
+`
+
+// load writes the config file, and the overlays of profiles, to a temporary directory and loads it
+func load(t *testing.T, profileName string, overlays map[string]string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ip2country.yaml")
+	if err := os.WriteFile(file, []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, overlay := range overlays {
+		if err := os.WriteFile(filepath.Join(dir, "ip2country."+name+".yaml"), []byte(overlay), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	viper.Reset()
+	SetFile(file)
+	SetProfile(profileName)
+	t.Cleanup(func() {
+		viper.Reset()
+		SetFile("")
+		SetProfile("")
+	})
+	return LoadConfig()
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	cfg, err := load(t, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 8080 || cfg.BurstLimit != 5 || len(cfg.DB) != 2 {
+		t.Errorf("Expected the settings of the config file, got %+v", cfg)
+	}
+	if !strings.HasSuffix(Source(), "ip2country.yaml") {
+		t.Errorf("Expected the config file as source, got %s", Source())
+	}
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	overlays := map[string]string{"prod": `
+logger:
+  serviceVersion: "1.2.3"
+RATE_LIMIT: 50
+TRUSTED_PROXIES: ["192.168.0.0/16"]
+`}
+
+	cfg, err := load(t, "prod", overlays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimit != 50 || cfg.BurstLimit != 5 {
+		t.Errorf("Expected the rate limit of the overlay and the burst of the config file, got %d and %d", cfg.RateLimit, cfg.BurstLimit)
+	}
+	if cfg.Logger.Level != "info" || cfg.Logger.ServiceVersion != "1.2.3" {
+		t.Errorf("Expected the logger settings to be merged, got %+v", cfg.Logger)
+	}
+	if len(cfg.TrustedProxies) != 1 || cfg.TrustedProxies[0] != "192.168.0.0/16" {
+		t.Errorf("Expected the list of the overlay to replace the config file's, got %v", cfg.TrustedProxies)
+	}
+	if !strings.HasSuffix(Source(), "ip2country.prod.yaml") {
+		t.Errorf("Expected the overlay in the source, got %s", Source())
+	}
+
+	if _, err := load(t, "staging", overlays); err == nil || !strings.Contains(err.Error(), "staging profile") {
+		t.Errorf("Expected an error for a profile without overlay, got %v", err)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		check       func(cfg *Config) bool
+		expectedErr string
+	}{
+		{
+			name:  "Top-level key",
+			env:   map[string]string{"IP2COUNTRY_RATE_LIMIT": "7", "IP2COUNTRY_PORT": "9090"},
+			check: func(cfg *Config) bool { return cfg.RateLimit == 7 && cfg.Port == 9090 },
+		},
+		{
+			name: "Key sharing a prefix with another",
+			env:  map[string]string{"IP2COUNTRY_RATE_LIMIT_KEY": "header", "IP2COUNTRY_RATE_LIMIT_HEADER": "X-Tenant"},
+			check: func(cfg *Config) bool {
+				return cfg.RateLimitKey == "header" && cfg.RateLimitHeader == "X-Tenant" && cfg.RateLimit == 1
+			},
+		},
+		{
+			name:  "Nested key",
+			env:   map[string]string{"IP2COUNTRY_LOGGER_LEVEL": "debug", "IP2COUNTRY_LOGGER_FILE_MAXSIZEMB": "5"},
+			check: func(cfg *Config) bool { return cfg.Logger.Level == "debug" && cfg.Logger.File.MaxSizeMB == 5 },
+		},
+		{
+			name: "List entry",
+			env:  map[string]string{"IP2COUNTRY_DB_1_HOST": "https://geo.example.org/?ip"},
+			check: func(cfg *Config) bool {
+				return cfg.DB[1].Host == "https://geo.example.org/?ip" && cfg.DB[1].Name == API && cfg.DB[0].Host == "db/geolite2.zip"
+			},
+		},
+		{
+			name: "New list entry",
+			env:  map[string]string{"IP2COUNTRY_RATELIMITOVERRIDES_0_KEY": "partner", "IP2COUNTRY_RATELIMITOVERRIDES_0_RATE": "10", "IP2COUNTRY_RATELIMITOVERRIDES_0_BURST": "20"},
+			check: func(cfg *Config) bool {
+				return len(cfg.RateLimitOverrides) == 1 && cfg.RateLimitOverrides[0] == RateLimitOverride{Key: "partner", Rate: 10, Burst: 20}
+			},
+		},
+		{
+			name:  "Whole list",
+			env:   map[string]string{"IP2COUNTRY_TRUSTED_PROXIES": "10.0.0.1,10.0.0.2"},
+			check: func(cfg *Config) bool { return len(cfg.TrustedProxies) == 2 && cfg.TrustedProxies[1] == "10.0.0.2" },
+		},
+		{
+			name:  "Unprefixed and unknown variables are ignored",
+			env:   map[string]string{"PORT": "1", "IP2COUNTRY_SERVICE_HOST": "10.0.0.1"},
+			check: func(cfg *Config) bool { return cfg.Port == 8080 },
+		},
+		{
+			name: "Kubernetes service links are ignored",
+			env: map[string]string{
+				"IP2COUNTRY_PORT": "tcp://10.0.0.1:8080", "IP2COUNTRY_PORT_8080_TCP": "tcp://10.0.0.1:8080",
+				"IP2COUNTRY_PORT_8080_TCP_PORT": "8080", "IP2COUNTRY_RATE_LIMIT": "7",
+			},
+			check: func(cfg *Config) bool { return cfg.Port == 8080 && cfg.RateLimit == 7 },
+		},
+		{
+			name:        "List entry out of range",
+			env:         map[string]string{"IP2COUNTRY_DB_3_HOST": "db/other.zip"},
+			expectedErr: "IP2COUNTRY_DB_3_HOST: index 3 is out of range",
+		},
+		{
+			name:        "Invalid value",
+			env:         map[string]string{"IP2COUNTRY_BURST_LIMIT": "0"},
+			expectedErr: "BURST_LIMIT: must be at least 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := load(t, "", nil)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Unexpected configuration %+v", cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Reloadable are the settings applied while the service runs when the config file changes.
+// Every other setting is read once at startup.
+type Reloadable struct {
+	RateLimit          int
+	BurstLimit         int
+	RateLimitOverrides []RateLimitOverride
+	TrustedProxies     []string
+	LogLevel           string
+	APIHost            string `secret:"url"`
+}
+
+// Reloadable returns the settings of c that can change at runtime
+func (c *Config) Reloadable() Reloadable {
+	r := Reloadable{
+		RateLimit:          c.RateLimit,
+		BurstLimit:         c.BurstLimit,
+		RateLimitOverrides: c.RateLimitOverrides,
+		TrustedProxies:     c.TrustedProxies,
+		LogLevel:           c.Logger.Level,
+	}
+	for _, db := range c.DB {
+		if db.Name == API {
+			r.APIHost = db.Host
+		}
+	}
+	return r
+}
+
+// Reload returns a copy of c updated with the Reloadable settings of next, along with the names of those that changed
+func (c *Config) Reload(next *Config) (*Config, []string) {
+	updated := *c
+	r := next.Reloadable()
+	updated.RateLimit = r.RateLimit
+	updated.BurstLimit = r.BurstLimit
+	updated.RateLimitOverrides = r.RateLimitOverrides
+	updated.TrustedProxies = r.TrustedProxies
+	updated.Logger.Level = r.LogLevel
+	updated.DB = slices.Clone(c.DB)
+	for i := range updated.DB {
+		if updated.DB[i].Name == API {
+			updated.DB[i].Host = r.APIHost
+		}
+	}
+
+	var changed []string
+	previous, current := reflect.ValueOf(c.Reloadable()), reflect.ValueOf(updated.Reloadable())
+	for i := range previous.NumField() {
+		if !reflect.DeepEqual(previous.Field(i).Interface(), current.Field(i).Interface()) {
+			changed = append(changed, previous.Type().Field(i).Name)
+		}
+	}
+	return &updated, changed
+}
+
+// Watch reloads the config file whenever it changes. When the new file is valid and changes Reloadable settings,
+// apply is called with the previous configuration and a copy of it updated with them. Invalid files are ignored.
+func Watch(current *Config, apply func(previous, next *Config)) {
+	var mu sync.Mutex
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Viper only rereads the config file, the overlay of the profile is merged again on top of it
+		if err := mergeProfile(); err != nil {
+			slog.Error(fmt.Sprintf("%s Ignoring changes to %s: %v", configLogPrefix, e.Name, err))
+			return
+		}
+		var next Config
+		if err := viper.Unmarshal(&next); err != nil {
+			slog.Error(fmt.Sprintf("%s Ignoring changes to %s, unable to decode: %v", configLogPrefix, e.Name, err))
+			return
+		}
+		// Secret files are read again, so a rotated secret of the API host applies with the reload
+		if err := resolveSecrets(&next); err != nil {
+			slog.Error(fmt.Sprintf("%s Ignoring changes to %s, unable to read secrets:\n%v", configLogPrefix, e.Name, err))
+			return
+		}
+		if err := next.Validate(); err != nil {
+			slog.Error(fmt.Sprintf("%s Ignoring changes to %s, invalid configuration:\n%v", configLogPrefix, e.Name, err))
+			return
+		}
+
+		updated, changed := current.Reload(&next)
+		if !reflect.DeepEqual(*updated, next) {
+			slog.Warn(fmt.Sprintf("%s Changes to %s other than %s require a restart", configLogPrefix, e.Name,
+				strings.Join(reloadableNames(), ", ")))
+		}
+		if len(changed) == 0 {
+			return
+		}
+
+		slog.Info(fmt.Sprintf("%s Reloading %s from %s", configLogPrefix, strings.Join(changed, ", "), e.Name))
+		for _, change := range describeChanges(current.Reloadable(), updated.Reloadable(), changed) {
+			slog.Info(configLogPrefix + change)
+		}
+		apply(current, updated)
+		current = updated
+	})
+	viper.WatchConfig()
+}
+
+// describeChanges returns a line per changed setting with its previous and new value, secrets redacted
+func describeChanges(previous, next Reloadable, changed []string) []string {
+	before, after := reflect.ValueOf(previous), reflect.ValueOf(next)
+	lines := make([]string, 0, len(changed))
+	for _, name := range changed {
+		field, _ := before.Type().FieldByName(name)
+		secret := field.Tag.Get("secret")
+		lines = append(lines, fmt.Sprintf("[%s] = [%s] -> [%s]", name,
+			formatValue(before.FieldByName(name), secret), formatValue(after.FieldByName(name), secret)))
+	}
+	return lines
+}
+
+// formatValue renders a setting on a single line, redacting the strings tagged secret in it
+func formatValue(value reflect.Value, secret string) string {
+	switch value.Kind() {
+	case reflect.String:
+		return redact(value.String(), secret)
+	case reflect.Slice:
+		elements := make([]string, value.Len())
+		for i := range value.Len() {
+			elements[i] = formatValue(value.Index(i), secret)
+		}
+		return strings.Join(elements, ", ")
+	case reflect.Struct:
+		fields := make([]string, value.NumField())
+		for i := range value.NumField() {
+			field := value.Type().Field(i)
+			fields[i] = field.Name + ":" + formatValue(value.Field(i), field.Tag.Get("secret"))
+		}
+		return "{" + strings.Join(fields, " ") + "}"
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+func reloadableNames() []string {
+	t := reflect.TypeOf(Reloadable{})
+	names := make([]string, t.NumField())
+	for i := range t.NumField() {
+		names[i] = t.Field(i).Name
+	}
+	return names
+}
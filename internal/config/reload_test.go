@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	current := validConfig()
+	current.DB = append(current.DB, DBConfig{Host: "https://api.example.com/geo.json?host", Name: API})
+	current.TrustedProxies = []string{"10.0.0.0/8"}
+
+	tests := []struct {
+		name            string
+		modify          func(cfg *Config)
+		expectedChanged []string
+		expectedRestart bool
+	}{
+		{
+			name:   "Nothing changed",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:            "Rate limits",
+			modify:          func(cfg *Config) { cfg.RateLimit, cfg.BurstLimit = 10, 20 },
+			expectedChanged: []string{"RateLimit", "BurstLimit"},
+		},
+		{
+			name:            "Log level and trusted proxies",
+			modify:          func(cfg *Config) { cfg.Logger.Level, cfg.TrustedProxies = "debug", nil },
+			expectedChanged: []string{"TrustedProxies", "LogLevel"},
+		},
+		{
+			name: "API provider",
+			modify: func(cfg *Config) {
+				cfg.DB = []DBConfig{cfg.DB[0], {Host: "https://geo.example.org/?ip", Name: API}}
+			},
+			expectedChanged: []string{"APIHost"},
+		},
+		{
+			name:            "Port requires a restart",
+			modify:          func(cfg *Config) { cfg.Port, cfg.RateLimit = 9090, 2 },
+			expectedChanged: []string{"RateLimit"},
+			expectedRestart: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := *current
+			next.DB = append([]DBConfig(nil), current.DB...)
+			tt.modify(&next)
+
+			updated, changed := current.Reload(&next)
+			if !reflect.DeepEqual(changed, tt.expectedChanged) {
+				t.Errorf("Expected changes %v, got %v", tt.expectedChanged, changed)
+			}
+			if !reflect.DeepEqual(updated.Reloadable(), next.Reloadable()) {
+				t.Errorf("Expected the reloadable settings %+v, got %+v", next.Reloadable(), updated.Reloadable())
+			}
+			if restart := !reflect.DeepEqual(*updated, next); restart != tt.expectedRestart {
+				t.Errorf("Expected a restart to be required: %v, got %v", tt.expectedRestart, restart)
+			}
+			if updated.Port != current.Port {
+				t.Errorf("Expected the port to be kept, got %d", updated.Port)
+			}
+		})
+	}
+}
+
+func TestDescribeChanges(t *testing.T) {
+	previous := Reloadable{
+		RateLimit:          1,
+		RateLimitOverrides: []RateLimitOverride{{Key: "old-key", Rate: 5}},
+		APIHost:            "https://api.example.com/json/?key=old-secret",
+	}
+	next := Reloadable{
+		RateLimit:          2,
+		RateLimitOverrides: []RateLimitOverride{{Key: "new-key", Rate: 10, Kind: RateLimitByAPIKey}},
+		APIHost:            "https://api.example.com/json/?key=new-secret",
+	}
+
+	lines := describeChanges(previous, next, []string{"RateLimit", "RateLimitOverrides", "APIHost"})
+	expected := []string{
+		"[RateLimit] = [1] -> [2]",
+		"[RateLimitOverrides] = [{Key:REDACTED Rate:5 Burst:0 Kind:}] -> [{Key:REDACTED Rate:10 Burst:0 Kind:api_key}]",
+		"[APIHost] = [https://api.example.com/json/?key=REDACTED] -> [https://api.example.com/json/?key=REDACTED]",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, lines)
+	}
+}
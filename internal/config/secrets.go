@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// redacted replaces secrets in logs
+	redacted = "REDACTED"
+	// Values of the secret struct tag: secretFull hides the whole value, secretURL the password and query values of
+	// a URL, such as an API key passed as a parameter
+	secretFull = "true"
+	secretURL  = "url"
+	// minResolvedSecretLength is the length below which a value read from a secret reference is not hidden in the
+	// logs, as a value such as "1" or "true" would blank out every unrelated setting containing it
+	minResolvedSecretLength = 8
+)
+
+// secretReference matches ${file:/path} and ${env:NAME} in config values
+var secretReference = regexp.MustCompile(`\$\{(file|env):([^}]+)\}`)
+
+// resolvedSecrets are the values read from secret references, hidden wherever they appear in logs. Values shorter
+// than minResolvedSecretLength are left out.
+var resolvedSecrets struct {
+	sync.Mutex
+	values []string
+}
+
+// resolveSecrets replaces the ${file:/path} and ${env:NAME} references in every string of cfg with the content of
+// the file, without its trailing line break, or the value of the environment variable. Secrets can thus be kept out
+// of the config file, e.g. in Docker or Kubernetes secrets mounted in /run/secrets.
+func resolveSecrets(cfg *Config) error {
+	var errs []error
+	var values []string
+	resolveValue(reflect.ValueOf(cfg).Elem(), "", &values, &errs)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	resolvedSecrets.Lock()
+	resolvedSecrets.values = values
+	resolvedSecrets.Unlock()
+	return nil
+}
+
+func resolveValue(v reflect.Value, path string, values *[]string, errs *[]error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			resolveValue(v.Field(i), strings.TrimPrefix(path+"."+fieldKey(v.Type().Field(i)), "."), values, errs)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), values, errs)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			resolveValue(v.Elem(), path, values, errs)
+		}
+	case reflect.String:
+		if !strings.Contains(v.String(), "${") {
+			return
+		}
+		resolved := secretReference.ReplaceAllStringFunc(v.String(), func(reference string) string {
+			match := secretReference.FindStringSubmatch(reference)
+			secret, err := readSecret(match[1], match[2])
+			if err != nil {
+				*errs = append(*errs, fmt.Errorf("%s: %w", path, err))
+				return reference
+			}
+			if len(secret) >= minResolvedSecretLength {
+				*values = append(*values, secret)
+			}
+			return secret
+		})
+		v.SetString(resolved)
+	}
+}
+
+func readSecret(source, name string) (string, error) {
+	switch source {
+	case "file":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s of the secret is not set", name)
+		}
+		return value, nil
+	}
+}
+
+// redact hides the secrets of value before it is logged. mode is the secret tag of its field: "true" hides the whole
+// value, and "url" the password and query values of a URL. Values read from secret references are always hidden,
+// unless shorter than minResolvedSecretLength.
+func redact(value, mode string) string {
+	if value == "" {
+		return value
+	}
+	switch mode {
+	case secretFull:
+		return redacted
+	case secretURL:
+		value = redactURL(value)
+	}
+	resolvedSecrets.Lock()
+	defer resolvedSecrets.Unlock()
+	for _, secret := range resolvedSecrets.values {
+		value = strings.ReplaceAll(value, secret, redacted)
+	}
+	return value
+}
+
+// RedactURL hides the secrets of a URL before it is logged, like the settings tagged secret:"url"
+func RedactURL(value string) string {
+	return redact(value, secretURL)
+}
+
+// RedactQuery hides the values of the given parameters of a raw URL query, such as API keys, along with any resolved
+// secret, before it is logged. The other parameters are kept, unlike RedactURL.
+func RedactQuery(query string, params ...string) string {
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		for _, param := range params {
+			if strings.EqualFold(name, param) {
+				parts[i] = part[:len(part)-len(value)] + redacted
+				break
+			}
+		}
+	}
+	return redact(strings.Join(parts, "&"), "")
+}
+
+// redactURL hides the password and the values of the query parameters of a URL, keeping the parameter names.
+// A value that is not a URL is hidden entirely.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		if name, paramValue, ok := strings.Cut(param, "="); ok && paramValue != "" {
+			params[i] = name + "=" + redacted
+		}
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return u.String()
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validator collects every problem of a configuration, so they can all be fixed at once
+type validator struct {
+	errs []error
+}
+
+func (v *validator) addf(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+// oneOf checks that value is one of allowed, reporting the allowed values otherwise
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.addf("%s: unknown value %q, expected one of %s", field, value, strings.Join(allowed, ", "))
+}
+
+func (v *validator) port(field string, value int, optional bool) {
+	if optional && value == 0 {
+		return
+	}
+	if value < 1 || value > 65535 {
+		v.addf("%s: %d is not a valid port, expected 1 to 65535", field, value)
+	}
+}
+
+// Validate checks every field of the configuration along with the rules between them. All problems found are
+// returned together, one per line.
+func (c *Config) Validate() error {
+	v := &validator{}
+	c.validateStores(v)
+	c.validateServers(v)
+	c.validateRateLimit(v)
+	c.validateSecurity(v)
+	c.validateObservability(v)
+	return errors.Join(v.errs...)
+}
+
+func (c *Config) validateStores(v *validator) {
+	v.oneOf("ACTIVE_DATA_STORE", string(c.ActiveDataStore), string(Local), string(API), string(Relational))
+	found := false
+	for i, db := range c.DB {
+		v.oneOf(fmt.Sprintf("db[%d].name", i), string(db.Name), string(Local), string(API), string(Relational))
+		if db.Host == "" {
+			v.addf("db[%d].host: must be set", i)
+		}
+		if db.Name == c.ActiveDataStore {
+			found = true
+		}
+	}
+	// Only the API store reads its entry: the local store is loaded from --zippath and the relational store takes
+	// no settings yet. An unknown store is reported above.
+	if !found && c.ActiveDataStore == API {
+		v.addf("db: no entry named %q for the ACTIVE_DATA_STORE, add one with its host", c.ActiveDataStore)
+	}
+}
+
+func (c *Config) validateServers(v *validator) {
+	v.port("port", c.Port, false)
+	v.port("GRPC_PORT", c.GrpcPort, true)
+	v.port("DNS_PORT", c.DNSPort, true)
+	if c.GrpcPort != 0 && c.GrpcPort == c.Port {
+		v.addf("GRPC_PORT: %d is already used by the HTTP port", c.GrpcPort)
+	}
+	if c.DNSPort != 0 && c.DNSZone == "" {
+		v.addf("DNS_ZONE: must be set when DNS_PORT is set")
+	}
+	// DNS queries carry no credentials, the interface would answer the clients authentication keeps out
+	if c.DNSPort != 0 && c.AuthEnabled {
+		v.addf("DNS_PORT: the DNS interface cannot authenticate clients, disable it when AUTH_ENABLED is set")
+	}
+
+	for _, timeout := range []struct {
+		field string
+		value time.Duration
+	}{
+		{"READ_TIMEOUT", c.ReadTimeout},
+		{"READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"WRITE_TIMEOUT", c.WriteTimeout},
+		{"IDLE_TIMEOUT", c.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			v.addf("%s: must not be negative", timeout.field)
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		v.addf("SHUTDOWN_TIMEOUT: must be positive, e.g. \"15s\"")
+	}
+	if c.MaxHeaderBytes <= 0 {
+		v.addf("MAX_HEADER_BYTES: must be positive")
+	}
+
+	for i, l := range c.Listeners {
+		field := fmt.Sprintf("listeners[%d]", i)
+		if l.Network != "" {
+			v.oneOf(field+".network", l.Network, ListenerTCP, ListenerUnix, ListenerSystemd)
+		}
+		if l.Profile != "" {
+			v.oneOf(field+".profile", l.Profile, ProfilePublic, ProfileInternal)
+		}
+		// Internal listeners serve the unauthenticated /admin endpoints, which must not be reachable over the network
+		if l.Profile == ProfileInternal && cmp.Or(l.Network, ListenerTCP) == ListenerTCP {
+			v.addf("%s.profile: %s listeners must be unix or systemd sockets, not tcp", field, ProfileInternal)
+		}
+		if l.Address == "" && l.Network != ListenerSystemd {
+			v.addf("%s.address: must be set for tcp and unix listeners", field)
+		}
+		if l.Mode != "" {
+			if l.Network != ListenerUnix {
+				v.addf("%s.mode: only applies to unix listeners", field)
+			} else if _, err := strconv.ParseUint(l.Mode, 8, 32); err != nil {
+				v.addf("%s.mode: %q is not an octal permission, e.g. \"0660\"", field, l.Mode)
+			}
+		}
+	}
+}
+
+func (c *Config) validateRateLimit(v *validator) {
+	if c.RateLimit <= 0 {
+		v.addf("RATE_LIMIT: must be positive, got %d", c.RateLimit)
+	}
+	if c.BurstLimit < 1 {
+		v.addf("BURST_LIMIT: must be at least 1, got %d", c.BurstLimit)
+	}
+	v.oneOf("RATE_LIMIT_KEY", c.RateLimitKey, RateLimitByIP, RateLimitByAPIKey, RateLimitByHeader, RateLimitByClientCert)
+	if c.RateLimitKey == RateLimitByHeader && c.RateLimitHeader == "" {
+		v.addf("RATE_LIMIT_HEADER: must be set when RATE_LIMIT_KEY is %s", RateLimitByHeader)
+	}
+	if c.RateLimitKey == RateLimitByAPIKey && !c.AuthEnabled {
+		v.addf("RATE_LIMIT_KEY: %s requires AUTH_ENABLED, only known keys get their own bucket", RateLimitByAPIKey)
+	}
+	if c.RateLimitKey == RateLimitByClientCert && c.TLS.ClientCAFile == "" {
+		v.addf("RATE_LIMIT_KEY: %s requires tls.clientCAFile to verify client certificates", RateLimitByClientCert)
+	}
+	v.oneOf("RATE_LIMIT_BACKEND", c.RateLimitBackend, RateLimitBackendMemory, RateLimitBackendRedis)
+	if c.RateLimitBackend == RateLimitBackendRedis && c.RedisAddr == "" {
+		v.addf("REDIS_ADDR: must be set when RATE_LIMIT_BACKEND is %s", RateLimitBackendRedis)
+	}
+	for i, override := range c.RateLimitOverrides {
+		if override.Key == "" {
+			v.addf("rateLimitOverrides[%d].key: must be set", i)
+		}
+		if override.Rate <= 0 || override.Burst < 1 {
+			v.addf("rateLimitOverrides[%d]: rate must be positive and burst at least 1", i)
+		}
+		if override.Kind != "" {
+			v.oneOf(fmt.Sprintf("rateLimitOverrides[%d].kind", i), override.Kind,
+				RateLimitByIP, RateLimitByAPIKey, RateLimitByHeader, RateLimitByClientCert)
+		}
+	}
+}
+
+func (c *Config) validateSecurity(v *validator) {
+	for i, proxy := range c.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.addf("TRUSTED_PROXIES[%d]: %q is neither an address nor a CIDR", i, proxy)
+		}
+	}
+
+	if c.AuthEnabled && len(c.Auth.Keys) == 0 && c.Auth.KeysFile == "" {
+		v.addf("auth: AUTH_ENABLED requires keys or a keysFile, every request would be rejected")
+	}
+	for i, key := range c.Auth.Keys {
+		if key.Key == "" && key.Subject == "" {
+			v.addf("auth.keys[%d]: must have a key or a subject", i)
+		}
+		if key.DailyQuota < 0 || key.MonthlyQuota < 0 {
+			v.addf("auth.keys[%d]: quotas must not be negative", i)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		v.addf("tls: certFile and keyFile must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		v.addf("tls.clientCAFile: requires certFile and keyFile, client certificates are only verified over TLS")
+	}
+	if (c.TLS.HealthCheckCertFile == "") != (c.TLS.HealthCheckKeyFile == "") {
+		v.addf("tls: healthCheckCertFile and healthCheckKeyFile must be set together")
+	}
+	if c.TLS.ClientAuth != "" {
+		v.oneOf("tls.clientAuth", c.TLS.ClientAuth, TLSClientAuthRequire, TLSClientAuthOptional)
+	}
+}
+
+func (c *Config) validateObservability(v *validator) {
+	if c.Logger.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.Logger.Level)); err != nil {
+			v.addf("logger.level: unknown level %q, expected debug, info, warn or error", c.Logger.Level)
+		}
+	}
+
+	if c.Logger.Format != "" {
+		v.oneOf("logger.format", c.Logger.Format, LogFormatJSON, LogFormatText, LogFormatTint)
+	}
+	if c.Logger.Output != "" {
+		v.oneOf("logger.output", c.Logger.Output, LogOutputStdout, LogOutputStderr, LogOutputFile)
+	}
+	if c.Logger.Output == LogOutputFile && c.Logger.File.Path == "" {
+		v.addf("logger.file.path: must be set when the output is %s", LogOutputFile)
+	}
+	if c.Logger.File.MaxSizeMB < 0 || c.Logger.File.MaxAgeDays < 0 || c.Logger.File.MaxBackups < 0 {
+		v.addf("logger.file: rotation settings must not be negative")
+	}
+
+	if c.Tracing.Exporter != "" {
+		v.oneOf("tracing.exporter", c.Tracing.Exporter, TracingExporterNone, TracingExporterStdout, TracingExporterOTLP)
+	}
+	if c.Tracing.Exporter == TracingExporterOTLP && c.Tracing.Endpoint == "" {
+		v.addf("tracing.endpoint: must be set when the exporter is %s", TracingExporterOTLP)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.addf("tracing.sampleRatio: %v is out of range, expected 0 to 1", c.Tracing.SampleRatio)
+	}
+}
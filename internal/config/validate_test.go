@@ -0,0 +1,174 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a configuration passing validation, to be broken by each test case
+func validConfig() *Config {
+	return &Config{
+		DB:               []DBConfig{{Host: "db/geolite2.zip", Name: Local}},
+		ActiveDataStore:  Local,
+		RateLimit:        1,
+		BurstLimit:       5,
+		RateLimitKey:     RateLimitByIP,
+		RateLimitBackend: RateLimitBackendMemory,
+		MaxHeaderBytes:   1 << 20,
+		ShutdownTimeout:  15 * time.Second,
+		Port:             8080,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(cfg *Config)
+		expectedError string
+	}{
+		{
+			name:   "Valid configuration",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:          "Unknown data store",
+			modify:        func(cfg *Config) { cfg.ActiveDataStore = "lcoal" },
+			expectedError: `ACTIVE_DATA_STORE: unknown value "lcoal"`,
+		},
+		{
+			name:          "Missing db entry for the active store",
+			modify:        func(cfg *Config) { cfg.ActiveDataStore = API },
+			expectedError: `db: no entry named "api"`,
+		},
+		{
+			name:   "Local store without a db entry",
+			modify: func(cfg *Config) { cfg.ActiveDataStore, cfg.DB = Local, nil },
+		},
+		{
+			name:          "Zero rate limit",
+			modify:        func(cfg *Config) { cfg.RateLimit = 0 },
+			expectedError: "RATE_LIMIT: must be positive",
+		},
+		{
+			name:          "Invalid port",
+			modify:        func(cfg *Config) { cfg.Port = 70000 },
+			expectedError: "port: 70000 is not a valid port",
+		},
+		{
+			name:          "gRPC port shared with HTTP",
+			modify:        func(cfg *Config) { cfg.GrpcPort = 8080 },
+			expectedError: "GRPC_PORT: 8080 is already used",
+		},
+		{
+			name:          "Header key without header",
+			modify:        func(cfg *Config) { cfg.RateLimitKey = RateLimitByHeader },
+			expectedError: "RATE_LIMIT_HEADER: must be set",
+		},
+		{
+			name:          "API key buckets without authentication",
+			modify:        func(cfg *Config) { cfg.RateLimitKey = RateLimitByAPIKey },
+			expectedError: "RATE_LIMIT_KEY: api_key requires AUTH_ENABLED",
+		},
+		{
+			name: "Unknown override kind",
+			modify: func(cfg *Config) {
+				cfg.RateLimitOverrides = []RateLimitOverride{{Key: "10.0.0.7", Rate: 1, Burst: 1, Kind: "address"}}
+			},
+			expectedError: `rateLimitOverrides[0].kind: unknown value "address"`,
+		},
+		{
+			name: "DNS with authentication",
+			modify: func(cfg *Config) {
+				cfg.DNSPort, cfg.AuthEnabled, cfg.Auth.Keys = 5353, true, []APIKey{{Key: "s3cr3t", Name: "team-a"}}
+			},
+			expectedError: "DNS_PORT: the DNS interface cannot authenticate clients",
+		},
+		{
+			name:          "Invalid trusted proxy",
+			modify:        func(cfg *Config) { cfg.TrustedProxies = []string{"10.0.0.0/33"} },
+			expectedError: "TRUSTED_PROXIES[0]",
+		},
+		{
+			name:          "Authentication without keys",
+			modify:        func(cfg *Config) { cfg.AuthEnabled = true },
+			expectedError: "auth: AUTH_ENABLED requires keys",
+		},
+		{
+			name:          "Certificate without key",
+			modify:        func(cfg *Config) { cfg.TLS.CertFile = "server.crt" },
+			expectedError: "tls: certFile and keyFile must be set together",
+		},
+		{
+			name:          "Health check certificate without key",
+			modify:        func(cfg *Config) { cfg.TLS.HealthCheckCertFile = "healthcheck.crt" },
+			expectedError: "tls: healthCheckCertFile and healthCheckKeyFile must be set together",
+		},
+		{
+			name: "Invalid socket mode",
+			modify: func(cfg *Config) {
+				cfg.Listeners = []ListenerConfig{{Network: ListenerUnix, Address: "/run/ip2country.sock", Mode: "rw"}}
+			},
+			expectedError: "listeners[0].mode",
+		},
+		{
+			name: "Internal tcp listener",
+			modify: func(cfg *Config) {
+				cfg.Listeners = []ListenerConfig{{Address: "10.0.0.5:9000", Profile: ProfileInternal}}
+			},
+			expectedError: "listeners[0].profile: internal listeners must be unix or systemd sockets",
+		},
+		{
+			name:          "Unknown log level",
+			modify:        func(cfg *Config) { cfg.Logger.Level = "verbose" },
+			expectedError: `logger.level: unknown level "verbose"`,
+		},
+		{
+			name:          "Unknown log format",
+			modify:        func(cfg *Config) { cfg.Logger.Format = "xml" },
+			expectedError: `logger.format: unknown value "xml"`,
+		},
+		{
+			name:          "Log file output without path",
+			modify:        func(cfg *Config) { cfg.Logger.Output = LogOutputFile },
+			expectedError: "logger.file.path: must be set",
+		},
+		{
+			name:          "Sample ratio out of range",
+			modify:        func(cfg *Config) { cfg.Tracing.SampleRatio = 2 },
+			expectedError: "tracing.sampleRatio",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	cfg := validConfig()
+	cfg.RateLimit = 0
+	cfg.BurstLimit = 0
+	cfg.Port = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if lines := strings.Split(err.Error(), "\n"); len(lines) != 3 {
+		t.Errorf("Expected one line per problem, got %q", lines)
+	}
+}
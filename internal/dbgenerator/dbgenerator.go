@@ -4,10 +4,15 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gocarina/gocsv"
 	"github.com/yl2chen/cidranger"
@@ -20,9 +25,23 @@ const (
 	CityFile = "GeoLite2-City-Locations-en.csv"
 )
 
+const (
+	DropEmptyGeonameID  = "empty geoname_id"
+	DropUnknownLocation = "unknown location"
+)
+
 type DbGenerator struct {
 	subnetInfo []store.SubnetInfo
+	dropped    []DroppedBlock
 	tree       cidranger.Ranger
+	buildDate  time.Time
+}
+
+// DroppedBlock is a block of the zip left out of the database, and why
+type DroppedBlock struct {
+	Network   string `json:"network"`
+	GeonameID string `json:"geoname_id,omitempty"`
+	Reason    string `json:"reason"` // DropEmptyGeonameID or DropUnknownLocation
 }
 
 type SubnetInfoCSV struct {
@@ -31,9 +50,10 @@ type SubnetInfoCSV struct {
 }
 
 type CountryInfo struct {
-	CountryCode string `csv:"geoname_id"`
-	CountryName string `csv:"country_name"`
-	CityName    string `csv:"city_name"`
+	CountryCode    string `csv:"geoname_id"`
+	CountryISOCode string `csv:"country_iso_code"`
+	CountryName    string `csv:"country_name"`
+	CityName       string `csv:"city_name"`
 }
 
 func NewCustomRangerEntry(ipNet net.IPNet, data store.SubnetInfo) cidranger.RangerEntry {
@@ -51,6 +71,26 @@ func (s *DbGenerator) Close() {
 	s.tree = nil
 }
 
+// Entries returns the subnets loaded from the zip or the gob file
+func (s *DbGenerator) Entries() []store.SubnetInfo {
+	return s.subnetInfo
+}
+
+// Dropped returns the blocks left out when importing a zip. Files saved by SaveInfo do not record them.
+func (s *DbGenerator) Dropped() []DroppedBlock {
+	return s.dropped
+}
+
+// Tree returns the CIDR tree built by BuildCIDRTree
+func (s *DbGenerator) Tree() cidranger.Ranger {
+	return s.tree
+}
+
+// BuildDate returns the modification time of the newest CSV file the database was built from
+func (s *DbGenerator) BuildDate() time.Time {
+	return s.buildDate
+}
+
 func (s *DbGenerator) DirectFromZip(zipFilePath string) (cidranger.Ranger, error) {
 	err := s.UnzipAndPrepareData(zipFilePath)
 	if err != nil {
@@ -72,7 +112,11 @@ func (s *DbGenerator) UnzipAndPrepareData(zipFilePath string) error {
 
 	var blocks []SubnetInfoCSV
 	var locations []CountryInfo
+	var buildDate time.Time
 	for _, file := range zipReader.File {
+		if file.Modified.After(buildDate) {
+			buildDate = file.Modified
+		}
 		zippedFile, err := file.Open()
 		if err != nil {
 			return fmt.Errorf("failed to open file %s from zip: %v", file.Name, err)
@@ -97,22 +141,34 @@ func (s *DbGenerator) UnzipAndPrepareData(zipFilePath string) error {
 		locationMap[location.CountryCode] = location
 	}
 	subnetsInfo := make([]store.SubnetInfo, 0)
+	dropped := make([]DroppedBlock, 0)
+	unknown := 0
 	for _, block := range blocks {
 		if block.CountryCode == "" {
+			dropped = append(dropped, DroppedBlock{Network: block.Subnet, Reason: DropEmptyGeonameID})
 			continue
 		}
 		countryInfo, ok := locationMap[block.CountryCode]
 		if !ok {
-			slog.Error(fmt.Sprintf("Country code %s not found in locations", block.CountryCode))
+			slog.Debug(fmt.Sprintf("Country code %s not found in locations", block.CountryCode))
+			dropped = append(dropped, DroppedBlock{Network: block.Subnet, GeonameID: block.CountryCode, Reason: DropUnknownLocation})
+			unknown++
 			continue
 		}
 		subnetsInfo = append(subnetsInfo, store.SubnetInfo{
-			Subnet:  block.Subnet,
-			Country: countryInfo.CountryName,
-			City:    countryInfo.CityName,
+			Subnet:      block.Subnet,
+			Country:     countryInfo.CountryName,
+			City:        countryInfo.CityName,
+			CountryCode: countryInfo.CountryISOCode,
 		})
 	}
+	// Some releases drop blocks by the thousand, so they are logged one by one at debug level only
+	if unknown > 0 {
+		slog.Warn(fmt.Sprintf("Dropped %d blocks whose geoname_id is not found in locations", unknown))
+	}
 	s.subnetInfo = subnetsInfo
+	s.dropped = dropped
+	s.buildDate = buildDate.UTC()
 	return nil
 }
 
@@ -143,7 +199,7 @@ func insertCIDR(tree cidranger.Ranger, cidr string, info store.SubnetInfo) error
 	return nil
 }
 
-// SaveInfo saves the subnet info to a file
+// SaveInfo saves the subnet info to a file, followed by the build date
 func (s *DbGenerator) SaveInfo(filename string) error {
 
 	var buf bytes.Buffer
@@ -151,6 +207,9 @@ func (s *DbGenerator) SaveInfo(filename string) error {
 	if err := encoder.Encode(s.subnetInfo); err != nil {
 		return err
 	}
+	if err := encoder.Encode(s.buildDate); err != nil {
+		return err
+	}
 	return os.WriteFile(filename, buf.Bytes(), 0600)
 }
 
@@ -167,10 +226,25 @@ func (s *DbGenerator) LoadEntries(filename string) error {
 	if err := decoder.Decode(&entries); err != nil {
 		return err
 	}
+	// Files saved before the build date was recorded end right after the entries
+	var buildDate time.Time
+	if err := decoder.Decode(&buildDate); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
 	s.subnetInfo = entries
+	s.dropped = nil
+	s.buildDate = buildDate
 	return nil
 }
 
+// Load loads the entries of a database file: a GeoLite2 zip, or a file saved by SaveInfo such as geodata.dat
+func (s *DbGenerator) Load(path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return s.UnzipAndPrepareData(path)
+	}
+	return s.LoadEntries(path)
+}
+
 func (s *DbGenerator) TryLoadFromGob(filename string) (cidranger.Ranger, error) {
 	err := s.LoadEntries(filename)
 	if err != nil {
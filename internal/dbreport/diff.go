@@ -0,0 +1,198 @@
+package dbreport
+
+import (
+	"cmp"
+	"net"
+	"slices"
+
+	"ip2country/pkg/store"
+)
+
+// Location is where the addresses of a network are
+type Location struct {
+	Country     string `json:"country"`
+	CountryCode string `json:"country_code"`
+	City        string `json:"city"`
+}
+
+// sameCountry reports whether l and other are in the same country, comparing their ISO codes when both have one and
+// their names otherwise, so that a location without a code is not compared with the code of another
+func (l Location) sameCountry(other Location) bool {
+	if l.CountryCode != "" && other.CountryCode != "" {
+		return l.CountryCode == other.CountryCode
+	}
+	return l.Country == other.Country
+}
+
+// label names the country of a location in the movements, its ISO code or its name for databases without codes
+func (l Location) label() string {
+	return cmp.Or(l.CountryCode, l.Country)
+}
+
+// Network is a network of a database and its location
+type Network struct {
+	Network string `json:"network"`
+	Location
+}
+
+// Change is a network whose location differs between two databases
+type Change struct {
+	Network string   `json:"network"`
+	Before  Location `json:"before"`
+	After   Location `json:"after"`
+}
+
+// CountryMovement counts the networks a country gained and lost between two databases
+type CountryMovement struct {
+	Country  string `json:"country"`
+	Added    int    `json:"added"`     // networks added in the new database
+	Removed  int    `json:"removed"`   // networks removed from the old database
+	MovedIn  int    `json:"moved_in"`  // networks moved from another country
+	MovedOut int    `json:"moved_out"` // networks moved to another country
+	Net      int    `json:"net"`       // networks gained, negative when the country lost some
+}
+
+// Diff describes what changed between two databases
+type Diff struct {
+	Old         string    `json:"old"`
+	New         string    `json:"new"`
+	OldNetworks int       `json:"old_networks"`
+	NewNetworks int       `json:"new_networks"`
+	Added       []Network `json:"added"`
+	Removed     []Network `json:"removed"`
+	// CountryChanged lists the networks moved to another country, CityChanged those moved within their country
+	CountryChanged []Change `json:"country_changed"`
+	CityChanged    []Change `json:"city_changed"`
+	// Countries lists the countries whose networks changed, the largest movements first
+	Countries []CountryMovement `json:"countries"`
+	// Changes counts the networks added, removed or whose location changed, ChangedPercent relates them to the
+	// networks of the old database
+	Changes        int     `json:"changes"`
+	ChangedPercent float64 `json:"changed_percent"`
+}
+
+// DiffFiles loads two database files, each a GeoLite2 zip or a file saved by SaveInfo, and compares them
+func DiffFiles(oldPath, newPath string) (*Diff, error) {
+	before, err := Load(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	after, err := Load(newPath)
+	if err != nil {
+		return nil, err
+	}
+	diff := Compare(before.Entries(), after.Entries())
+	diff.Old, diff.New = oldPath, newPath
+	return diff, nil
+}
+
+// Compare returns what changed from the entries of an old database to the entries of a new one. Networks are matched
+// by their CIDR notation, so a network split in two is reported as removed, and its halves as added.
+func Compare(before, after []store.SubnetInfo) *Diff {
+	oldNetworks, newNetworks := locations(before), locations(after)
+	// Lists are empty rather than nil, so that JSON reports always hold them
+	diff := &Diff{
+		OldNetworks:    len(oldNetworks),
+		NewNetworks:    len(newNetworks),
+		Added:          []Network{},
+		Removed:        []Network{},
+		CountryChanged: []Change{},
+		CityChanged:    []Change{},
+		Countries:      []CountryMovement{},
+	}
+	movements := make(map[string]*CountryMovement)
+	movement := func(country string) *CountryMovement {
+		if movements[country] == nil {
+			movements[country] = &CountryMovement{Country: country}
+		}
+		return movements[country]
+	}
+
+	for _, network := range sortedKeys(oldNetworks) {
+		previous := oldNetworks[network]
+		current, ok := newNetworks[network]
+		switch {
+		case !ok:
+			diff.Removed = append(diff.Removed, Network{Network: network, Location: previous})
+			movement(previous.label()).Removed++
+		case !current.sameCountry(previous):
+			diff.CountryChanged = append(diff.CountryChanged, Change{Network: network, Before: previous, After: current})
+			movement(previous.label()).MovedOut++
+			movement(current.label()).MovedIn++
+		case current.City != previous.City:
+			diff.CityChanged = append(diff.CityChanged, Change{Network: network, Before: previous, After: current})
+		}
+	}
+	for _, network := range sortedKeys(newNetworks) {
+		if _, ok := oldNetworks[network]; !ok {
+			current := newNetworks[network]
+			diff.Added = append(diff.Added, Network{Network: network, Location: current})
+			movement(current.label()).Added++
+		}
+	}
+
+	for _, m := range movements {
+		m.Net = m.Added + m.MovedIn - m.Removed - m.MovedOut
+		diff.Countries = append(diff.Countries, *m)
+	}
+	slices.SortFunc(diff.Countries, func(a, b CountryMovement) int {
+		return cmp.Or(cmp.Compare(moved(b), moved(a)), cmp.Compare(a.Country, b.Country))
+	})
+
+	diff.Changes = len(diff.Added) + len(diff.Removed) + len(diff.CountryChanged) + len(diff.CityChanged)
+	switch {
+	case diff.OldNetworks > 0:
+		diff.ChangedPercent = float64(diff.Changes) * 100 / float64(diff.OldNetworks)
+	case diff.Changes > 0:
+		diff.ChangedPercent = 100
+	}
+	return diff
+}
+
+// moved is the number of networks of a country that changed in any way
+func moved(m CountryMovement) int {
+	return m.Added + m.Removed + m.MovedIn + m.MovedOut
+}
+
+// locations maps the networks of entries, in canonical CIDR notation, to their location
+func locations(entries []store.SubnetInfo) map[string]Location {
+	result := make(map[string]Location, len(entries))
+	for _, entry := range entries {
+		network := entry.Subnet
+		if _, ipNet, err := net.ParseCIDR(network); err == nil {
+			network = ipNet.String()
+		}
+		result[network] = Location{Country: entry.Country, CountryCode: entry.CountryCode, City: entry.City}
+	}
+	return result
+}
+
+// sortedKeys returns the networks of m ordered by family, first address and prefix length, with invalid networks last,
+// so that the reports are stable
+func sortedKeys(m map[string]Location) []string {
+	type sortKey struct {
+		network string
+		invalid int
+		bits    int
+		ip      net.IP
+		ones    int
+	}
+	keys := make([]sortKey, 0, len(m))
+	for network := range m {
+		key := sortKey{network: network, invalid: 1}
+		if _, ipNet, err := net.ParseCIDR(network); err == nil {
+			key.ones, key.bits = ipNet.Mask.Size()
+			key.invalid, key.ip = 0, ipNet.IP.To16()
+		}
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b sortKey) int {
+		return cmp.Or(cmp.Compare(a.invalid, b.invalid), cmp.Compare(a.bits, b.bits), slices.Compare(a.ip, b.ip),
+			cmp.Compare(a.ones, b.ones), cmp.Compare(a.network, b.network))
+	})
+	networks := make([]string, len(keys))
+	for i, key := range keys {
+		networks[i] = key.network
+	}
+	return networks
+}
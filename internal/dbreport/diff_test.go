@@ -0,0 +1,124 @@
+package dbreport_test
+
+import (
+	"reflect"
+	"testing"
+
+	sut "ip2country/internal/dbreport"
+	"ip2country/pkg/store"
+)
+
+func TestCompare(t *testing.T) {
+	before := []store.SubnetInfo{
+		{Subnet: "10.0.0.0/8", Country: "Israel", CountryCode: "IL", City: "Tel Aviv"},
+		{Subnet: "10.1.0.0/16", Country: "Israel", CountryCode: "IL", City: "Haifa"},
+		{Subnet: "192.168.0.0/16", Country: "United States", CountryCode: "US"},
+		{Subnet: "172.16.0.0/12", Country: "France", CountryCode: "FR", City: "Paris"},
+	}
+	after := []store.SubnetInfo{
+		{Subnet: "10.0.0.0/8", Country: "Israel", CountryCode: "IL", City: "Tel Aviv"},
+		{Subnet: "10.1.0.0/16", Country: "Israel", CountryCode: "IL", City: "Jerusalem"},
+		{Subnet: "192.168.0.0/16", Country: "Israel", CountryCode: "IL"},
+		{Subnet: "2001:db8::/32", Country: "France", CountryCode: "FR", City: "Lyon"},
+		{Subnet: "203.0.113.0/24", Country: "France", CountryCode: "FR", City: "Lyon"},
+	}
+
+	diff := sut.Compare(before, after)
+
+	tests := []struct {
+		name     string
+		actual   any
+		expected any
+	}{
+		{"networks", [2]int{diff.OldNetworks, diff.NewNetworks}, [2]int{4, 5}},
+		{"added", diff.Added, []sut.Network{
+			{Network: "203.0.113.0/24", Location: sut.Location{Country: "France", CountryCode: "FR", City: "Lyon"}},
+			{Network: "2001:db8::/32", Location: sut.Location{Country: "France", CountryCode: "FR", City: "Lyon"}},
+		}},
+		{"removed", diff.Removed, []sut.Network{
+			{Network: "172.16.0.0/12", Location: sut.Location{Country: "France", CountryCode: "FR", City: "Paris"}},
+		}},
+		{"country changed", diff.CountryChanged, []sut.Change{{
+			Network: "192.168.0.0/16",
+			Before:  sut.Location{Country: "United States", CountryCode: "US"},
+			After:   sut.Location{Country: "Israel", CountryCode: "IL"},
+		}}},
+		{"city changed", diff.CityChanged, []sut.Change{{
+			Network: "10.1.0.0/16",
+			Before:  sut.Location{Country: "Israel", CountryCode: "IL", City: "Haifa"},
+			After:   sut.Location{Country: "Israel", CountryCode: "IL", City: "Jerusalem"},
+		}}},
+		{"countries", diff.Countries, []sut.CountryMovement{
+			{Country: "FR", Added: 2, Removed: 1, Net: 1},
+			{Country: "IL", MovedIn: 1, Net: 1},
+			{Country: "US", MovedOut: 1, Net: -1},
+		}},
+		{"changes", diff.Changes, 5},
+		{"changed percent", diff.ChangedPercent, 125.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.actual, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, tt.actual)
+			}
+		})
+	}
+}
+
+func TestCompareMatchesCanonicalNetworks(t *testing.T) {
+	// 10.1.2.3/8 is 10.0.0.0/8 written with host bits, the same network
+	before := []store.SubnetInfo{{Subnet: "10.1.2.3/8", CountryCode: "IL"}}
+	after := []store.SubnetInfo{{Subnet: "10.0.0.0/8", CountryCode: "IL"}}
+	if diff := sut.Compare(before, after); diff.Changes != 0 {
+		t.Errorf("Expected no changes, got %+v", diff)
+	}
+}
+
+func TestCompareMixedLocations(t *testing.T) {
+	// Databases without ISO codes, or with names that differ between releases, are compared by what both sides have
+	before := []store.SubnetInfo{
+		{Subnet: "10.0.0.0/8", Country: "Israel", CountryCode: "IL"},
+		{Subnet: "172.16.0.0/12", Country: "United States", CountryCode: "US"},
+		{Subnet: "192.168.0.0/16", Country: "France", CountryCode: "FR"},
+		{Subnet: "203.0.113.0/24", Country: "Germany"},
+	}
+	after := []store.SubnetInfo{
+		{Subnet: "10.0.0.0/8", Country: "Israel"},
+		{Subnet: "172.16.0.0/12", Country: "United States of America", CountryCode: "US"},
+		{Subnet: "192.168.0.0/16", Country: "Germany"},
+		{Subnet: "203.0.113.0/24", Country: "France", CountryCode: "FR"},
+	}
+
+	diff := sut.Compare(before, after)
+	expected := []sut.Change{
+		{
+			Network: "192.168.0.0/16",
+			Before:  sut.Location{Country: "France", CountryCode: "FR"},
+			After:   sut.Location{Country: "Germany"},
+		},
+		{
+			Network: "203.0.113.0/24",
+			Before:  sut.Location{Country: "Germany"},
+			After:   sut.Location{Country: "France", CountryCode: "FR"},
+		},
+	}
+	if !reflect.DeepEqual(diff.CountryChanged, expected) {
+		t.Errorf("Expected country changes %+v, got %+v", expected, diff.CountryChanged)
+	}
+	if diff.Changes != 2 {
+		t.Errorf("Expected 2 changes, got %d", diff.Changes)
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	diff, err := sut.DiffFiles(testZip, testZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Changes != 0 || diff.OldNetworks == 0 || diff.OldNetworks != diff.NewNetworks {
+		t.Errorf("Expected a file to have no changes with itself, got %d changes of %d networks", diff.Changes, diff.OldNetworks)
+	}
+	if _, err := sut.DiffFiles(testZip, "missing.zip"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
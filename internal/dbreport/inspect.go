@@ -0,0 +1,179 @@
+// Package dbreport Description: This package summarizes and compares the contents of database files.
+package dbreport
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"ip2country/internal/dbgenerator"
+	"ip2country/pkg/store"
+)
+
+// Family counts the networks of an IP family by prefix length
+type Family struct {
+	Networks int         `json:"networks"`
+	Prefixes map[int]int `json:"prefixes"` // networks by prefix length
+}
+
+// Overlap is a network contained in another network of the database
+type Overlap struct {
+	Network string `json:"network"`
+	Within  string `json:"within"`
+}
+
+// Summary describes the contents of a database file
+type Summary struct {
+	Path      string    `json:"path"`
+	BuildDate time.Time `json:"build_date"`
+	Networks  int       `json:"networks"`
+	IPv4      Family    `json:"ipv4"`
+	IPv6      Family    `json:"ipv6"`
+	// Invalid lists the networks that are not in CIDR notation
+	Invalid   []string `json:"invalid"`
+	Countries int      `json:"countries"`
+	Cities    int      `json:"cities"`
+	// IPv4Coverage is the percentage of the IPv4 address space covered by the networks
+	IPv4Coverage float64 `json:"ipv4_coverage_percent"`
+	// Duplicates lists the networks found more than once, Overlaps the networks within another one
+	Duplicates []string  `json:"duplicates"`
+	Overlaps   []Overlap `json:"overlaps"`
+	// Dropped lists the blocks left out during the import. It is nil when the file does not record them, as geodata.dat.
+	Dropped []dbgenerator.DroppedBlock `json:"dropped"`
+}
+
+// DroppedByReason counts the dropped blocks by reason
+func (s *Summary) DroppedByReason() map[string]int {
+	counts := make(map[string]int)
+	for _, block := range s.Dropped {
+		counts[block.Reason]++
+	}
+	return counts
+}
+
+// Load loads a database file, a GeoLite2 zip or a file saved by SaveInfo such as geodata.dat
+func Load(path string) (*dbgenerator.DbGenerator, error) {
+	generator := dbgenerator.NewDbGenerator()
+	if err := generator.Load(path); err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", path, err)
+	}
+	return generator, nil
+}
+
+// Inspect loads the database file at path and summarizes it
+func Inspect(path string) (*Summary, error) {
+	generator, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	summary := Summarize(generator.Entries(), generator.Dropped())
+	summary.Path = path
+	summary.BuildDate = generator.BuildDate()
+	return summary, nil
+}
+
+// network is a parsed entry of the database
+type network struct {
+	cidr  string
+	ipNet *net.IPNet
+	ones  int
+}
+
+// Summarize describes entries, and the blocks dropped while importing them
+func Summarize(entries []store.SubnetInfo, dropped []dbgenerator.DroppedBlock) *Summary {
+	summary := &Summary{
+		Networks: len(entries),
+		IPv4:     Family{Prefixes: make(map[int]int)},
+		IPv6:     Family{Prefixes: make(map[int]int)},
+		Dropped:  dropped,
+	}
+	countries := make(map[string]bool)
+	cities := make(map[[2]string]bool)
+	var v4, v6 []network
+	for _, entry := range entries {
+		if code := cmp.Or(entry.CountryCode, entry.Country); code != "" {
+			countries[code] = true
+			if entry.City != "" {
+				cities[[2]string{code, entry.City}] = true
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry.Subnet)
+		if err != nil {
+			summary.Invalid = append(summary.Invalid, entry.Subnet)
+			continue
+		}
+		ones, _ := ipNet.Mask.Size()
+		// IPv4-mapped networks such as ::ffff:1.2.3.0/120 have an IPv6 mask, they are counted as IPv6
+		if len(ipNet.Mask) == net.IPv4len {
+			ipNet.IP = ipNet.IP.To4()
+			summary.IPv4.Networks++
+			summary.IPv4.Prefixes[ones]++
+			v4 = append(v4, network{cidr: entry.Subnet, ipNet: ipNet, ones: ones})
+		} else {
+			summary.IPv6.Networks++
+			summary.IPv6.Prefixes[ones]++
+			v6 = append(v6, network{cidr: entry.Subnet, ipNet: ipNet, ones: ones})
+		}
+	}
+	summary.Countries = len(countries)
+	summary.Cities = len(cities)
+
+	for _, networks := range [][]network{v4, v6} {
+		duplicates, overlaps := overlapping(networks)
+		summary.Duplicates = append(summary.Duplicates, duplicates...)
+		summary.Overlaps = append(summary.Overlaps, overlaps...)
+	}
+	summary.IPv4Coverage = coverage(v4)
+	return summary
+}
+
+// sortNetworks orders networks by first address, larger networks first
+func sortNetworks(networks []network) {
+	slices.SortStableFunc(networks, func(a, b network) int {
+		return cmp.Or(bytes.Compare(a.ipNet.IP, b.ipNet.IP), cmp.Compare(a.ones, b.ones))
+	})
+}
+
+// overlapping returns the networks found more than once, and the networks within another one, of a single family
+func overlapping(networks []network) ([]string, []Overlap) {
+	sortNetworks(networks)
+	var duplicates []string
+	var overlaps []Overlap
+	// enclosing holds the chain of networks containing the current one, the innermost last
+	var enclosing []network
+	for i, n := range networks {
+		if i > 0 && n.ones == networks[i-1].ones && n.ipNet.IP.Equal(networks[i-1].ipNet.IP) {
+			duplicates = append(duplicates, n.cidr)
+			continue
+		}
+		for len(enclosing) > 0 && !enclosing[len(enclosing)-1].ipNet.Contains(n.ipNet.IP) {
+			enclosing = enclosing[:len(enclosing)-1]
+		}
+		if len(enclosing) > 0 {
+			overlaps = append(overlaps, Overlap{Network: n.cidr, Within: enclosing[len(enclosing)-1].cidr})
+		}
+		enclosing = append(enclosing, n)
+	}
+	return duplicates, overlaps
+}
+
+// coverage returns the percentage of the IPv4 address space covered by networks, counting overlaps once
+func coverage(networks []network) float64 {
+	sortNetworks(networks)
+	var covered, end uint64 // end is one past the last address covered so far
+	for _, n := range networks {
+		first := uint64(binary.BigEndian.Uint32(n.ipNet.IP.To4()))
+		last := first + 1<<(32-n.ones)
+		if last <= end {
+			continue
+		}
+		covered += last - max(first, end)
+		end = last
+	}
+	return float64(covered) * 100 / (1 << 32)
+}
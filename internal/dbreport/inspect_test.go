@@ -0,0 +1,96 @@
+package dbreport_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ip2country/internal/dbgenerator"
+	sut "ip2country/internal/dbreport"
+	"ip2country/pkg/store"
+)
+
+const testZip = "../ip2country/store/geolite2-test.zip"
+
+func TestSummarize(t *testing.T) {
+	entries := []store.SubnetInfo{
+		{Subnet: "10.0.0.0/8", Country: "Israel", CountryCode: "IL", City: "Tel Aviv"},
+		{Subnet: "10.1.0.0/16", Country: "Israel", CountryCode: "IL", City: "Haifa"},
+		{Subnet: "10.1.2.0/24", Country: "Israel", CountryCode: "IL", City: "Haifa"},
+		{Subnet: "10.1.2.0/24", Country: "Israel", CountryCode: "IL", City: "Haifa"},
+		{Subnet: "192.168.0.0/16", Country: "United States", CountryCode: "US"},
+		{Subnet: "2001:db8::/32", Country: "France", CountryCode: "FR", City: "Paris"},
+		{Subnet: "::ffff:1.2.3.0/120", Country: "France", CountryCode: "FR", City: "Paris"},
+		{Subnet: "not-a-network", Country: "France", CountryCode: "FR", City: "Paris"},
+	}
+	dropped := []dbgenerator.DroppedBlock{
+		{Network: "1.0.0.0/24", Reason: dbgenerator.DropEmptyGeonameID},
+		{Network: "1.0.1.0/24", GeonameID: "42", Reason: dbgenerator.DropUnknownLocation},
+	}
+
+	summary := sut.Summarize(entries, dropped)
+
+	tests := []struct {
+		name     string
+		actual   any
+		expected any
+	}{
+		{"networks", summary.Networks, 8},
+		{"IPv4", summary.IPv4, sut.Family{Networks: 5, Prefixes: map[int]int{8: 1, 16: 2, 24: 2}}},
+		{"IPv6", summary.IPv6, sut.Family{Networks: 2, Prefixes: map[int]int{32: 1, 120: 1}}},
+		{"invalid", summary.Invalid, []string{"not-a-network"}},
+		{"countries", summary.Countries, 3},
+		{"cities", summary.Cities, 3},
+		{"duplicates", summary.Duplicates, []string{"10.1.2.0/24"}},
+		{"overlaps", summary.Overlaps, []sut.Overlap{{Network: "10.1.0.0/16", Within: "10.0.0.0/8"}, {Network: "10.1.2.0/24", Within: "10.1.0.0/16"}}},
+		{"dropped", summary.DroppedByReason(), map[string]int{dbgenerator.DropEmptyGeonameID: 1, dbgenerator.DropUnknownLocation: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.actual, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, tt.actual)
+			}
+		})
+	}
+
+	// 10.0.0.0/8 and 192.168.0.0/16 cover 2^24 + 2^16 addresses, the networks within them are counted once
+	expected := float64(1<<24+1<<16) * 100 / (1 << 32)
+	if summary.IPv4Coverage != expected {
+		t.Errorf("Expected an IPv4 coverage of %v%%, got %v%%", expected, summary.IPv4Coverage)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	zipSummary, err := sut.Inspect(testZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zipSummary.Networks == 0 || zipSummary.Countries == 0 || zipSummary.IPv4Coverage <= 0 {
+		t.Errorf("Expected networks, countries and coverage, got %+v", zipSummary)
+	}
+	// The test zip has blocks without a geoname_id
+	if zipSummary.DroppedByReason()[dbgenerator.DropEmptyGeonameID] == 0 {
+		t.Error("Expected the blocks without a geoname_id to be reported as dropped")
+	}
+
+	// Files saved from the zip hold the same networks, but do not record the dropped blocks
+	generator, err := sut.Load(testZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat := filepath.Join(t.TempDir(), "geodata.dat")
+	if err := generator.SaveInfo(dat); err != nil {
+		t.Fatal(err)
+	}
+	datSummary, err := sut.Inspect(dat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datSummary.Networks != zipSummary.Networks || datSummary.Dropped != nil {
+		t.Errorf("Expected %d networks and no dropped blocks, got %d and %v", zipSummary.Networks, datSummary.Networks, datSummary.Dropped)
+	}
+
+	if _, err := sut.Inspect(filepath.Join(t.TempDir(), "missing.zip")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
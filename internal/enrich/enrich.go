@@ -0,0 +1,365 @@
+// Package enrich Description: This package adds the location of IP addresses to CSV, TSV and JSON Lines records.
+package enrich
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	stores "ip2country/internal/ip2country/store"
+	"ip2country/pkg/store"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+	FormatJSONL = "jsonl"
+
+	// maxLineSize bounds the size of a JSON line
+	maxLineSize = 1 << 20
+)
+
+// Options select the records format, where their IP address is and how the location is added
+type Options struct {
+	// Format of the records: csv, tsv or jsonl
+	Format string
+	// Column holding the IP address of CSV and TSV records, its name in the header or its position starting at 1
+	Column string
+	// NoHeader tells that CSV and TSV records have no header row, Column must then be a position
+	NoHeader bool
+	// Field is the path of the IP address in JSON records, keys and array indexes separated by dots, e.g. "client.ip"
+	Field string
+	// Prefix starts the names of the added columns or keys
+	Prefix string
+	// Workers is the number of concurrent lookups, the number of CPUs when 0
+	Workers int
+}
+
+// Stats report what an Enricher processed
+type Stats struct {
+	Records  int           // records read
+	Enriched int           // records whose address was found
+	NotFound int           // records whose address is not in the store
+	Failed   int           // records whose lookup failed for another reason, e.g. an unavailable store
+	Invalid  int           // records without an IP address, or unparsable
+	Elapsed  time.Duration // time spent processing
+}
+
+// Throughput returns the records processed per second
+func (s Stats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Records) / s.Elapsed.Seconds()
+}
+
+// Enricher adds the country, city and ISO country code of the IP address of every record. Records are looked up
+// concurrently and written in the order they were read.
+type Enricher struct {
+	store       store.Store
+	opts        Options
+	columns     []string
+	wroteHeader bool
+	stats       Stats
+}
+
+// New creates an Enricher looking up addresses in s
+func New(s store.Store, opts Options) (*Enricher, error) {
+	switch opts.Format {
+	case FormatCSV, FormatTSV:
+		if opts.Column == "" {
+			return nil, errors.New("the column of the IP address is required for CSV and TSV records")
+		}
+		if _, err := strconv.Atoi(opts.Column); err != nil && opts.NoHeader {
+			return nil, fmt.Errorf("column %s must be a position when records have no header", opts.Column)
+		}
+	case FormatJSONL:
+		if opts.Field == "" {
+			return nil, errors.New("the field of the IP address is required for JSON records")
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %s, expected %s, %s or %s", opts.Format, FormatCSV, FormatTSV, FormatJSONL)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	return &Enricher{
+		store:   s,
+		opts:    opts,
+		columns: []string{opts.Prefix + "country", opts.Prefix + "city", opts.Prefix + "country_code"},
+	}, nil
+}
+
+// Stats returns what was processed so far
+func (e *Enricher) Stats() Stats {
+	return e.stats
+}
+
+// item is a record on its way through the workers. done is closed once the record is enriched.
+type item struct {
+	record  []string // CSV and TSV fields
+	line    []byte   // JSON line
+	object  bool     // whether the JSON line is an object, other lines are written unchanged
+	address string
+	valid   bool
+	info    *store.SubnetInfo
+	err     error
+	done    chan struct{}
+}
+
+// Process enriches the records of in and writes them to out. The header of CSV and TSV records is only written
+// for the first input, so that several files can be processed into one output.
+func (e *Enricher) Process(ctx context.Context, in io.Reader, out io.Writer) error {
+	start := time.Now()
+	defer func() { e.stats.Elapsed += time.Since(start) }()
+
+	read, write, flush, err := e.codec(in, out)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan *item, e.opts.Workers)
+	// The queue keeps the order of the records and bounds how many are in flight
+	queue := make(chan *item, 4*e.opts.Workers)
+	for range e.opts.Workers {
+		go func() {
+			for it := range jobs {
+				if it.valid {
+					it.info, it.err = stores.LookupContext(ctx, e.store, net.ParseIP(it.address))
+				}
+				close(it.done)
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+		for {
+			it, err := read()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr <- err
+				}
+				return
+			}
+			it.done = make(chan struct{})
+			select {
+			case queue <- it:
+			case <-ctx.Done():
+				return
+			}
+			jobs <- it
+		}
+	}()
+
+	for it := range queue {
+		<-it.done
+		e.count(it)
+		if err := write(it); err != nil {
+			return err
+		}
+	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+	}
+	return flush()
+}
+
+func (e *Enricher) count(it *item) {
+	e.stats.Records++
+	switch {
+	case !it.valid:
+		e.stats.Invalid++
+	case errors.Is(it.err, store.ErrNotFound):
+		e.stats.NotFound++
+	case it.err != nil:
+		e.stats.Failed++
+	default:
+		e.stats.Enriched++
+	}
+}
+
+// values returns the added values of an enriched record, empty when its address was not found or its lookup failed
+func (e *Enricher) values(it *item) []string {
+	if !it.valid || it.err != nil || it.info == nil {
+		return []string{"", "", ""}
+	}
+	return []string{it.info.Country, it.info.City, it.info.CountryCode}
+}
+
+// codec returns the functions reading records from in, writing enriched records to out and flushing out
+func (e *Enricher) codec(in io.Reader, out io.Writer) (func() (*item, error), func(*item) error, func() error, error) {
+	if e.opts.Format == FormatJSONL {
+		return e.jsonCodec(in, out)
+	}
+	return e.csvCodec(in, out)
+}
+
+func (e *Enricher) csvCodec(in io.Reader, out io.Writer) (func() (*item, error), func(*item) error, func() error, error) {
+	reader := csv.NewReader(in)
+	writer := csv.NewWriter(out)
+	if e.opts.Format == FormatTSV {
+		reader.Comma, writer.Comma = '\t', '\t'
+		reader.LazyQuotes = true
+	}
+	reader.FieldsPerRecord = -1
+
+	column := -1
+	if position, err := strconv.Atoi(e.opts.Column); err == nil {
+		if position < 1 {
+			return nil, nil, nil, fmt.Errorf("column %d is out of range, positions start at 1", position)
+		}
+		column = position - 1
+	}
+	if !e.opts.NoHeader {
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return func() (*item, error) { return nil, io.EOF }, nil, func() error { return nil }, nil
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error reading the header: %w", err)
+		}
+		if column < 0 {
+			for i, name := range header {
+				if strings.TrimSpace(name) == e.opts.Column {
+					column = i
+					break
+				}
+			}
+			if column < 0 {
+				return nil, nil, nil, fmt.Errorf("no column named %s in the header", e.opts.Column)
+			}
+		}
+		if !e.wroteHeader {
+			if err := writer.Write(append(header, e.columns...)); err != nil {
+				return nil, nil, nil, err
+			}
+			e.wroteHeader = true
+		}
+	}
+
+	read := func() (*item, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		it := &item{record: record}
+		if column < len(record) {
+			it.address, it.valid = parseAddress(record[column])
+		}
+		return it, nil
+	}
+	write := func(it *item) error {
+		return writer.Write(append(it.record, e.values(it)...))
+	}
+	flush := func() error {
+		writer.Flush()
+		return writer.Error()
+	}
+	return read, write, flush, nil
+}
+
+func (e *Enricher) jsonCodec(in io.Reader, out io.Writer) (func() (*item, error), func(*item) error, func() error, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	writer := bufio.NewWriter(out)
+	path := strings.Split(e.opts.Field, ".")
+
+	read := func() (*item, error) {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			it := &item{line: append([]byte(nil), line...)}
+			var record map[string]any
+			if err := json.Unmarshal(line, &record); err == nil {
+				it.object = true
+				if value, ok := lookupPath(record, path).(string); ok {
+					it.address, it.valid = parseAddress(value)
+				}
+			}
+			return it, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	write := func(it *item) error {
+		line := it.line
+		// Keys are added to the original text, so the order and formatting of the other keys are kept
+		if it.object {
+			line = appendKeys(line, e.columns, e.values(it))
+		}
+		if _, err := writer.Write(line); err != nil {
+			return err
+		}
+		return writer.WriteByte('\n')
+	}
+	return read, write, writer.Flush, nil
+}
+
+// appendKeys adds keys with string values at the end of a JSON object
+func appendKeys(object []byte, keys, values []string) []byte {
+	body := bytes.TrimSpace(object[1 : len(object)-1])
+	result := append([]byte("{"), body...)
+	for i, key := range keys {
+		if i > 0 || len(body) > 0 {
+			result = append(result, ',')
+		}
+		k, _ := json.Marshal(key)
+		v, _ := json.Marshal(values[i])
+		result = append(append(append(result, k...), ':'), v...)
+	}
+	return append(result, '}')
+}
+
+// lookupPath returns the value at path in a decoded JSON value, nil when there is none
+func lookupPath(value any, path []string) any {
+	for _, key := range path {
+		switch node := value.(type) {
+		case map[string]any:
+			value = node[key]
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			value = node[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// parseAddress extracts an IP address from a field, which may carry a port as in "1.2.3.4:80" or "[::1]:80"
+func parseAddress(field string) (string, bool) {
+	field = strings.TrimSpace(field)
+	if ip := net.ParseIP(field); ip != nil {
+		return ip.String(), true
+	}
+	if host, _, err := net.SplitHostPort(field); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return ip.String(), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,162 @@
+package enrich_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	sut "ip2country/internal/enrich"
+	"ip2country/pkg/store"
+)
+
+type mockStore struct{}
+
+// GetInfoByIP knows the 8.8.0.0/16 network, and answers slower for lower addresses so lookups finish out of order.
+// Lookups of 9.9.9.9 fail.
+func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	if ip.String() == "9.9.9.9" {
+		return nil, errors.New("store unavailable")
+	}
+	ip4 := ip.To4()
+	if ip4 == nil || ip4[0] != 8 || ip4[1] != 8 {
+		return nil, store.ErrNotFound
+	}
+	time.Sleep(time.Duration(255-ip4[3]) * time.Microsecond)
+	return &store.SubnetInfo{Country: "United States", City: "Mountain View", CountryCode: "US", Subnet: "8.8.0.0/16"}, nil
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     sut.Options
+		input    string
+		expected string
+		stats    sut.Stats
+	}{
+		{
+			name:  "CSV with a header",
+			opts:  sut.Options{Format: sut.FormatCSV, Column: "client", Prefix: "geo_"},
+			input: "time,client\n1,8.8.8.8\n2,1.0.0.1\n3,oops\n",
+			expected: "time,client,geo_country,geo_city,geo_country_code\n" +
+				"1,8.8.8.8,United States,Mountain View,US\n2,1.0.0.1,,,\n3,oops,,,\n",
+			stats: sut.Stats{Records: 3, Enriched: 1, NotFound: 1, Invalid: 1},
+		},
+		{
+			name:     "CSV with a failed lookup",
+			opts:     sut.Options{Format: sut.FormatCSV, Column: "1", NoHeader: true},
+			input:    "9.9.9.9\n1.0.0.1\n",
+			expected: "9.9.9.9,,,\n1.0.0.1,,,\n",
+			stats:    sut.Stats{Records: 2, NotFound: 1, Failed: 1},
+		},
+		{
+			name:     "TSV without a header",
+			opts:     sut.Options{Format: sut.FormatTSV, Column: "2", NoHeader: true},
+			input:    "a\t8.8.4.4:53\nb\n",
+			expected: "a\t8.8.4.4:53\tUnited States\tMountain View\tUS\nb\t\t\t\n",
+			stats:    sut.Stats{Records: 2, Enriched: 1, Invalid: 1},
+		},
+		{
+			name:  "JSON Lines with a nested field",
+			opts:  sut.Options{Format: sut.FormatJSONL, Field: "client.ips.0"},
+			input: "{\"client\":{\"ips\":[\"8.8.8.8\"]}}\n\n{}\nnot json\n",
+			expected: "{\"client\":{\"ips\":[\"8.8.8.8\"]},\"country\":\"United States\",\"city\":\"Mountain View\",\"country_code\":\"US\"}\n" +
+				"{\"country\":\"\",\"city\":\"\",\"country_code\":\"\"}\nnot json\n",
+			stats: sut.Stats{Records: 3, Enriched: 1, Invalid: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := sut.New(&mockStore{}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := e.Process(context.Background(), strings.NewReader(tt.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected output\n%s\ngot\n%s", tt.expected, out.String())
+			}
+			stats := e.Stats()
+			stats.Elapsed = 0
+			if stats != tt.stats {
+				t.Errorf("Expected stats %+v, got %+v", tt.stats, stats)
+			}
+		})
+	}
+}
+
+func TestProcessKeepsOrder(t *testing.T) {
+	e, err := sut.New(&mockStore{}, sut.Options{Format: sut.FormatCSV, Column: "1", NoHeader: true, Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input, expected strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&input, "8.8.%d.%d\n", i/256, i%256)
+		fmt.Fprintf(&expected, "8.8.%d.%d,United States,Mountain View,US\n", i/256, i%256)
+	}
+	var out bytes.Buffer
+	if err := e.Process(context.Background(), strings.NewReader(input.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected.String() {
+		t.Error("Expected the records in the order they were read")
+	}
+	if stats := e.Stats(); stats.Records != 1000 || stats.Enriched != 1000 || stats.Throughput() <= 0 {
+		t.Errorf("Expected 1000 enriched records and a throughput, got %+v", stats)
+	}
+}
+
+func TestProcessWritesHeaderOnce(t *testing.T) {
+	e, err := sut.New(&mockStore{}, sut.Options{Format: sut.FormatCSV, Column: "ip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	for _, input := range []string{"ip\n8.8.8.8\n", "ip\n8.8.4.4\n"} {
+		if err := e.Process(context.Background(), strings.NewReader(input), &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "ip,country,city,country_code\n8.8.8.8,United States,Mountain View,US\n8.8.4.4,United States,Mountain View,US\n"
+	if out.String() != expected {
+		t.Errorf("Expected output\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestProcessUnknownColumn(t *testing.T) {
+	e, err := sut.New(&mockStore{}, sut.Options{Format: sut.FormatCSV, Column: "ip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Process(context.Background(), strings.NewReader("client\n8.8.8.8\n"), &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for a column missing from the header")
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts sut.Options
+	}{
+		{"unknown format", sut.Options{Format: "xml", Column: "ip"}},
+		{"CSV without a column", sut.Options{Format: sut.FormatCSV}},
+		{"column name without a header", sut.Options{Format: sut.FormatTSV, Column: "ip", NoHeader: true}},
+		{"JSON without a field", sut.Options{Format: sut.FormatJSONL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := sut.New(&mockStore{}, tt.opts); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
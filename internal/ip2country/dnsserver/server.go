@@ -0,0 +1,147 @@
+// Package dnsserver Description: This package contains the DNS interface for the ip2country service.
+// Lookups are answered Team Cymru style: the address is reversed under the configured zone, e.g.
+// "dig TXT 4.3.2.1.origin.ip2country" for 1.2.3.4, and IPv6 addresses use reversed nibbles.
+package dnsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"ip2country/internal/config"
+	stores "ip2country/internal/ip2country/store"
+	"ip2country/pkg/store"
+)
+
+// TTL is the time to live of the TXT records served
+const TTL = 3600
+
+type Server struct {
+	zone  string
+	store store.Store
+}
+
+// NewServer creates a DNS handler answering queries under zone from the given store
+func NewServer(zone string, s store.Store) *Server {
+	return &Server{zone: dns.Fqdn(strings.ToLower(zone)), store: s}
+}
+
+// StartServer answers queries on the configured DNS port over both UDP and TCP until ctx is done or either listener fails
+func StartServer(ctx context.Context, cfg *config.Config, s store.Store) error {
+	handler := NewServer(cfg.DNSZone, s)
+	addr := fmt.Sprintf(":%d", cfg.DNSPort)
+	errs := make(chan error, 2)
+	servers := make([]*dns.Server, 0, 2)
+	for _, network := range []string{"udp", "tcp"} {
+		server := &dns.Server{Addr: addr, Net: network, Handler: handler}
+		servers = append(servers, server)
+		go func() {
+			errs <- fmt.Errorf("%s DNS server stopped: %w", network, server.ListenAndServe())
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		// Shutting down a server that failed to start reports it is not started, which is not worth reporting
+		_ = server.ShutdownContext(shutdownCtx)
+	}
+	return err
+}
+
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+	defer func() {
+		if err := w.WriteMsg(resp); err != nil {
+			slog.Error(fmt.Sprintf("Error writing DNS response: %v", err))
+		}
+	}()
+
+	if len(req.Question) != 1 {
+		resp.SetRcode(req, dns.RcodeFormatError)
+		return
+	}
+	question := req.Question[0]
+	name := strings.ToLower(question.Name)
+	if !dns.IsSubDomain(s.zone, name) {
+		resp.SetRcode(req, dns.RcodeRefused)
+		return
+	}
+
+	ip := parseReversed(strings.TrimSuffix(strings.TrimSuffix(name, s.zone), "."))
+	if ip == nil {
+		resp.SetRcode(req, dns.RcodeNameError)
+		return
+	}
+
+	info, err := stores.Lookup(s.store, ip)
+	if err != nil && errors.Is(err, store.ErrNotFound) {
+		resp.SetRcode(req, dns.RcodeNameError)
+		return
+	} else if err != nil {
+		slog.Error(fmt.Sprintf("Error looking up %s for DNS query %s: %v", ip, question.Name, err))
+		resp.SetRcode(req, dns.RcodeServerFailure)
+		return
+	}
+
+	// Other record types of an existing name get an empty answer
+	if question.Qtype != dns.TypeTXT && question.Qtype != dns.TypeANY {
+		return
+	}
+	resp.Answer = append(resp.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: TTL},
+		Txt: []string{FormatTXT(info)},
+	})
+}
+
+// FormatTXT renders the record text: "prefix | country code | country | city"
+func FormatTXT(info *store.SubnetInfo) string {
+	return strings.Join([]string{info.Subnet, info.CountryCode, info.Country, info.City}, " | ")
+}
+
+// parseReversed converts "4.3.2.1" to 1.2.3.4, and 32 reversed hex nibbles to an IPv6 address
+func parseReversed(labels string) net.IP {
+	parts := strings.Split(labels, ".")
+	switch len(parts) {
+	case net.IPv4len:
+		ip := make(net.IP, net.IPv4len)
+		for i, part := range parts {
+			octet, err := strconv.ParseUint(part, 10, 8)
+			if err != nil {
+				return nil
+			}
+			ip[net.IPv4len-1-i] = byte(octet)
+		}
+		return ip
+	case 2 * net.IPv6len:
+		ip := make(net.IP, net.IPv6len)
+		for i, part := range parts {
+			nibble, err := strconv.ParseUint(part, 16, 4)
+			if err != nil || len(part) != 1 {
+				return nil
+			}
+			pos := len(parts) - 1 - i
+			if pos%2 == 0 {
+				ip[pos/2] |= byte(nibble) << 4
+			} else {
+				ip[pos/2] |= byte(nibble)
+			}
+		}
+		return ip
+	}
+	return nil
+}
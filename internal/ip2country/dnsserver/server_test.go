@@ -0,0 +1,147 @@
+package dnsserver_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	sut "ip2country/internal/ip2country/dnsserver"
+	"ip2country/pkg/store"
+)
+
+type mockStore struct{}
+
+func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	switch ip.String() {
+	case "2.22.233.255":
+		return &store.SubnetInfo{Subnet: "2.22.233.0/24", Country: "United Kingdom", City: "London", CountryCode: "GB"}, nil
+	case "2001:db8::1":
+		return &store.SubnetInfo{Subnet: "2001:db8::/32", Country: "Documentation", CountryCode: "ZZ"}, nil
+	case "10.0.0.1":
+		return nil, errors.New("internal error")
+	}
+	return nil, store.ErrNotFound
+}
+
+// startServer serves the zone on an ephemeral localhost port for the given network
+func startServer(t *testing.T, network string) string {
+	t.Helper()
+	started := make(chan struct{})
+	server := &dns.Server{
+		Net:               network,
+		Handler:           sut.NewServer("origin.example", &mockStore{}),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.PacketConn = pc
+	} else {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Listener = l
+	}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	if server.PacketConn != nil {
+		return server.PacketConn.LocalAddr().String()
+	}
+	return server.Listener.Addr().String()
+}
+
+func TestServeDNS(t *testing.T) {
+	tests := []struct {
+		name          string
+		qname         string
+		qtype         uint16
+		expectedRcode int
+		expectedTXT   string
+	}{
+		{
+			name:          "IPv4 TXT",
+			qname:         "255.233.22.2.origin.example.",
+			qtype:         dns.TypeTXT,
+			expectedRcode: dns.RcodeSuccess,
+			expectedTXT:   "2.22.233.0/24 | GB | United Kingdom | London",
+		},
+		{
+			name:          "IPv6 nibbles",
+			qname:         "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.origin.example.",
+			qtype:         dns.TypeTXT,
+			expectedRcode: dns.RcodeSuccess,
+			expectedTXT:   "2001:db8::/32 | ZZ | Documentation | ",
+		},
+		{
+			name:          "Not found",
+			qname:         "8.8.8.8.origin.example.",
+			qtype:         dns.TypeTXT,
+			expectedRcode: dns.RcodeNameError,
+		},
+		{
+			name:          "Malformed address",
+			qname:         "300.8.8.8.origin.example.",
+			qtype:         dns.TypeTXT,
+			expectedRcode: dns.RcodeNameError,
+		},
+		{
+			name:          "Outside zone",
+			qname:         "255.233.22.2.other.example.",
+			qtype:         dns.TypeTXT,
+			expectedRcode: dns.RcodeRefused,
+		},
+		{
+			name:          "Store error",
+			qname:         "1.0.0.10.origin.example.",
+			qtype:         dns.TypeTXT,
+			expectedRcode: dns.RcodeServerFailure,
+		},
+		{
+			name:          "Other record type",
+			qname:         "255.233.22.2.origin.example.",
+			qtype:         dns.TypeA,
+			expectedRcode: dns.RcodeSuccess,
+		},
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		addr := startServer(t, network)
+		client := &dns.Client{Net: network}
+
+		for _, tt := range tests {
+			t.Run(network+"/"+tt.name, func(t *testing.T) {
+				msg := new(dns.Msg)
+				msg.SetQuestion(tt.qname, tt.qtype)
+				resp, _, err := client.Exchange(msg, addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.Rcode != tt.expectedRcode {
+					t.Fatalf("Expected rcode %v, got %v", dns.RcodeToString[tt.expectedRcode], dns.RcodeToString[resp.Rcode])
+				}
+				if tt.expectedTXT == "" {
+					if len(resp.Answer) != 0 {
+						t.Errorf("Expected no answers, got %v", resp.Answer)
+					}
+					return
+				}
+				if len(resp.Answer) != 1 {
+					t.Fatalf("Expected one answer, got %v", resp.Answer)
+				}
+				txt, ok := resp.Answer[0].(*dns.TXT)
+				if !ok || len(txt.Txt) != 1 || txt.Txt[0] != tt.expectedTXT {
+					t.Errorf("Expected TXT %q, got %v", tt.expectedTXT, resp.Answer[0])
+				}
+			})
+		}
+	}
+}
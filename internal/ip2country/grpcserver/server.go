@@ -0,0 +1,176 @@
+// Package grpcserver Description: This package contains the gRPC API for the ip2country service.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"ip2country/internal/auth"
+	"ip2country/internal/config"
+	stores "ip2country/internal/ip2country/store"
+	ip2countryv1 "ip2country/pkg/api/ip2country/v1"
+	"ip2country/pkg/store"
+)
+
+// MaxBatchSize limits the number of addresses accepted by BatchLookup and StreamLookup
+const MaxBatchSize = 1000
+
+var authenticator *auth.Authenticator
+
+// SetAuthenticator requires an API key on the lookup calls of gRPC servers created afterwards
+func SetAuthenticator(a *auth.Authenticator) {
+	authenticator = a
+}
+
+type Server struct {
+	ip2countryv1.UnimplementedIP2CountryServiceServer
+	store store.Store
+}
+
+func NewServer(s store.Store) *Server {
+	return &Server{store: s}
+}
+
+// Register adds the lookup service and the standard health service to a gRPC server
+func Register(gs *grpc.Server, s store.Store) {
+	ip2countryv1.RegisterIP2CountryServiceServer(gs, NewServer(s))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(ip2countryv1.IP2CountryService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(gs, healthServer)
+}
+
+// NewGRPCServer creates a gRPC server authenticating calls with the authenticator set by SetAuthenticator, if any
+func NewGRPCServer() *grpc.Server {
+	if authenticator == nil {
+		return grpc.NewServer()
+	}
+	return grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authenticator.UnaryInterceptor),
+		grpc.ChainStreamInterceptor(authenticator.StreamInterceptor),
+	)
+}
+
+// StartServer listens on the configured gRPC port and serves until ctx is done or the listener fails.
+// Once ctx is done, in-flight calls are given SHUTDOWN_TIMEOUT to complete.
+func StartServer(ctx context.Context, cfg *config.Config, s store.Store) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GrpcPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen on gRPC port %d: %w", cfg.GrpcPort, err)
+	}
+	gs := NewGRPCServer()
+	Register(gs, s)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- gs.Serve(lis)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(cfg.ShutdownTimeout):
+		gs.Stop()
+		return errors.New("gRPC server did not drain in time")
+	}
+}
+
+func (s *Server) Lookup(ctx context.Context, req *ip2countryv1.LookupRequest) (*ip2countryv1.LookupResponse, error) {
+	ip := net.ParseIP(req.GetIp())
+	if ip == nil {
+		slog.Error(fmt.Sprintf("Invalid IP address: %v", req.GetIp()))
+		return nil, status.Error(codes.InvalidArgument, "Invalid IP address")
+	}
+
+	info, err := stores.LookupContext(ctx, s.store, ip)
+	if err != nil && errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &ip2countryv1.LookupResponse{
+		Country: info.Country,
+		City:    info.City,
+		Network: network(info),
+	}, nil
+}
+
+func (s *Server) BatchLookup(ctx context.Context, req *ip2countryv1.BatchLookupRequest) (*ip2countryv1.BatchLookupResponse, error) {
+	if len(req.GetIps()) > MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d addresses are allowed per request", MaxBatchSize)
+	}
+
+	results := make([]*ip2countryv1.LookupResult, 0, len(req.GetIps()))
+	for _, ip := range req.GetIps() {
+		results = append(results, s.lookupResult(ctx, ip))
+	}
+	return &ip2countryv1.BatchLookupResponse{Results: results}, nil
+}
+
+func (s *Server) StreamLookup(req *ip2countryv1.BatchLookupRequest, stream grpc.ServerStreamingServer[ip2countryv1.LookupResult]) error {
+	if len(req.GetIps()) > MaxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "at most %d addresses are allowed per request", MaxBatchSize)
+	}
+
+	for _, ip := range req.GetIps() {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.Send(s.lookupResult(stream.Context(), ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookupResult(ctx context.Context, ipStr string) *ip2countryv1.LookupResult {
+	result := &ip2countryv1.LookupResult{Ip: ipStr}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		result.Error = "Invalid IP address"
+		return result
+	}
+
+	info, err := stores.LookupContext(ctx, s.store, ip)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			result.Error = err.Error()
+		}
+		return result
+	}
+	result.Found = true
+	result.Country = info.Country
+	result.City = info.City
+	result.Network = network(info)
+	return result
+}
+
+// network returns the matched subnet when the store reports it in CIDR notation
+func network(info *store.SubnetInfo) string {
+	if _, ipNet, err := net.ParseCIDR(info.Subnet); err == nil {
+		return ipNet.String()
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package grpcserver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"ip2country/internal/auth"
+	"ip2country/internal/config"
+	sut "ip2country/internal/ip2country/grpcserver"
+	ip2countryv1 "ip2country/pkg/api/ip2country/v1"
+	"ip2country/pkg/store"
+)
+
+type mockStore struct{}
+
+func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	switch ip.String() {
+	case "2.22.233.255":
+		return &store.SubnetInfo{Subnet: "2.22.233.0/24", Country: "United Kingdom", City: "London"}, nil
+	case "10.0.0.1":
+		return nil, errors.New("internal error")
+	}
+	return nil, store.ErrNotFound
+}
+
+func newClient(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	gs := sut.NewGRPCServer()
+	sut.Register(gs, &mockStore{})
+	go func() {
+		_ = gs.Serve(lis)
+	}()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestLookup(t *testing.T) {
+	client := ip2countryv1.NewIP2CountryServiceClient(newClient(t))
+
+	tests := []struct {
+		name         string
+		ip           string
+		expectedCode codes.Code
+		expected     *ip2countryv1.LookupResponse
+	}{
+		{
+			name:         "Valid IP",
+			ip:           "2.22.233.255",
+			expectedCode: codes.OK,
+			expected:     &ip2countryv1.LookupResponse{Country: "United Kingdom", City: "London", Network: "2.22.233.0/24"},
+		},
+		{
+			name:         "Invalid IP",
+			ip:           "invalid-ip",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "IP not found",
+			ip:           "8.8.8.8",
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "Internal error",
+			ip:           "10.0.0.1",
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Lookup(context.Background(), &ip2countryv1.LookupRequest{Ip: tt.ip})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("Lookup returned wrong code: got %v want %v", code, tt.expectedCode)
+			}
+			if tt.expected == nil {
+				return
+			}
+			if resp.GetCountry() != tt.expected.GetCountry() || resp.GetCity() != tt.expected.GetCity() || resp.GetNetwork() != tt.expected.GetNetwork() {
+				t.Errorf("Lookup returned unexpected response: got %v want %v", resp, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBatchLookup(t *testing.T) {
+	client := ip2countryv1.NewIP2CountryServiceClient(newClient(t))
+
+	resp, err := client.BatchLookup(context.Background(), &ip2countryv1.BatchLookupRequest{
+		Ips: []string{"2.22.233.255", "8.8.8.8", "invalid-ip"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := resp.GetResults()
+	if len(results) != 3 {
+		t.Fatalf("BatchLookup returned %d results, want 3", len(results))
+	}
+	if !results[0].GetFound() || results[0].GetCountry() != "United Kingdom" {
+		t.Errorf("Expected first address to be found in United Kingdom, got %v", results[0])
+	}
+	if results[1].GetFound() || results[1].GetError() != "" {
+		t.Errorf("Expected second address to be not found without error, got %v", results[1])
+	}
+	if results[2].GetFound() || results[2].GetError() != "Invalid IP address" {
+		t.Errorf("Expected third address to be invalid, got %v", results[2])
+	}
+}
+
+func TestBatchLookupTooLarge(t *testing.T) {
+	client := ip2countryv1.NewIP2CountryServiceClient(newClient(t))
+
+	_, err := client.BatchLookup(context.Background(), &ip2countryv1.BatchLookupRequest{
+		Ips: make([]string, sut.MaxBatchSize+1),
+	})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("BatchLookup returned wrong code: got %v want %v", code, codes.InvalidArgument)
+	}
+}
+
+func TestStreamLookup(t *testing.T) {
+	client := ip2countryv1.NewIP2CountryServiceClient(newClient(t))
+
+	ips := []string{"2.22.233.255", "8.8.8.8", "2.22.233.255"}
+	stream, err := client.StreamLookup(context.Background(), &ip2countryv1.BatchLookupRequest{Ips: ips})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []*ip2countryv1.LookupResult
+	for {
+		result, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, result)
+	}
+
+	if len(received) != len(ips) {
+		t.Fatalf("StreamLookup returned %d results, want %d", len(received), len(ips))
+	}
+	for i, result := range received {
+		if result.GetIp() != ips[i] {
+			t.Errorf("StreamLookup returned results out of order: got %v want %v", result.GetIp(), ips[i])
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	client := healthpb.NewHealthClient(newClient(t))
+
+	for _, service := range []string{"", ip2countryv1.IP2CountryService_ServiceDesc.ServiceName} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Health check for %q returned %v, want SERVING", service, resp.GetStatus())
+		}
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(&config.Config{
+		Auth: config.AuthConfig{Keys: []config.APIKey{{Key: "s3cr3t", Name: "team-a", DailyQuota: 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authenticator.Close() }()
+	sut.SetAuthenticator(authenticator)
+	defer sut.SetAuthenticator(nil)
+	conn := newClient(t)
+	client := ip2countryv1.NewIP2CountryServiceClient(conn)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), auth.APIKeyMetadata, key)
+	}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		stream       bool
+		expectedCode codes.Code
+	}{
+		{"missing key", context.Background(), false, codes.Unauthenticated},
+		{"invalid key", withKey("guess"), false, codes.Unauthenticated},
+		{"missing key on a stream", context.Background(), true, codes.Unauthenticated},
+		{"valid key", withKey("s3cr3t"), false, codes.OK},
+		{"valid key on a stream", withKey("s3cr3t"), true, codes.OK},
+		{"over quota", withKey("s3cr3t"), false, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.stream {
+				var stream grpc.ServerStreamingClient[ip2countryv1.LookupResult]
+				stream, err = client.StreamLookup(tt.ctx, &ip2countryv1.BatchLookupRequest{Ips: []string{"2.22.233.255"}})
+				if err == nil {
+					_, err = stream.Recv()
+				}
+			} else {
+				_, err = client.Lookup(tt.ctx, &ip2countryv1.LookupRequest{Ip: "2.22.233.255"})
+			}
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Errorf("Expected code %v, got %v", tt.expectedCode, err)
+			}
+		})
+	}
+
+	// Probes check the health of the service without a key
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Expected the health service to answer without a key, got %v", err)
+	}
+}
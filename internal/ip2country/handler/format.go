@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocarina/gocsv"
+	"github.com/shamaton/msgpack/v2"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown format")
+	errNotAcceptable = errors.New("no acceptable format")
+)
+
+type format struct {
+	name        string
+	contentType string
+	encode      func(w io.Writer, resp response) error
+}
+
+var (
+	jsonFormat = format{
+		name:        "json",
+		contentType: "application/json",
+		encode: func(w io.Writer, resp response) error {
+			return json.NewEncoder(w).Encode(resp)
+		},
+	}
+	textFormat = format{
+		name:        "text",
+		contentType: "text/plain; charset=utf-8",
+		encode: func(w io.Writer, resp response) error {
+			_, err := fmt.Fprintln(w, resp.Country)
+			return err
+		},
+	}
+	csvFormat = format{
+		name:        "csv",
+		contentType: "text/csv; charset=utf-8",
+		encode: func(w io.Writer, resp response) error {
+			return gocsv.Marshal([]response{resp}, w)
+		},
+	}
+	xmlFormat = format{
+		name:        "xml",
+		contentType: "application/xml; charset=utf-8",
+		encode: func(w io.Writer, resp response) error {
+			if _, err := io.WriteString(w, xml.Header); err != nil {
+				return err
+			}
+			return xml.NewEncoder(w).Encode(resp)
+		},
+	}
+	msgpackFormat = format{
+		name:        "msgpack",
+		contentType: "application/msgpack",
+		encode: func(w io.Writer, resp response) error {
+			return msgpack.MarshalWrite(w, resp)
+		},
+	}
+)
+
+// formatsByName maps the values accepted by the format query parameter
+var formatsByName = map[string]format{
+	"json":    jsonFormat,
+	"text":    textFormat,
+	"txt":     textFormat,
+	"csv":     csvFormat,
+	"xml":     xmlFormat,
+	"msgpack": msgpackFormat,
+}
+
+// formatsByMediaType maps the media types understood in the Accept header
+var formatsByMediaType = map[string]format{
+	"application/json":        jsonFormat,
+	"text/plain":              textFormat,
+	"text/csv":                csvFormat,
+	"application/xml":         xmlFormat,
+	"text/xml":                xmlFormat,
+	"application/msgpack":     msgpackFormat,
+	"application/x-msgpack":   msgpackFormat,
+	"application/vnd.msgpack": msgpackFormat,
+	"application/*":           jsonFormat,
+	"text/*":                  textFormat,
+	"*/*":                     jsonFormat,
+}
+
+// negotiateFormat picks the response encoder. The format query parameter takes precedence over the Accept header,
+// and JSON is used when neither is given.
+func negotiateFormat(r *http.Request) (format, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		f, ok := formatsByName[strings.ToLower(name)]
+		if !ok {
+			return format{}, fmt.Errorf("%w: %s", errUnknownFormat, name)
+		}
+		return f, nil
+	}
+
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return jsonFormat, nil
+	}
+
+	type candidate struct {
+		format  format
+		quality float64
+	}
+	var candidates []candidate
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			f, ok := formatsByMediaType[mediaType]
+			if !ok {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil {
+					continue
+				}
+			}
+			if quality <= 0 {
+				continue
+			}
+			candidates = append(candidates, candidate{format: f, quality: quality})
+		}
+	}
+	if len(candidates) == 0 {
+		return format{}, errNotAcceptable
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	return candidates[0].format, nil
+}
+
+func writeResponse(w http.ResponseWriter, f format, resp response) {
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Add("Vary", "Accept")
+	_ = f.encode(w, resp)
+}
@@ -2,13 +2,16 @@
 package handler
 
 import (
-	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 
+	stores "ip2country/internal/ip2country/store"
 	"ip2country/internal/middleware"
 	"ip2country/pkg/store"
 )
@@ -16,8 +19,13 @@ import (
 var storeImpl store.Store
 
 type response struct {
-	Country string `json:"country"`
-	City    string `json:"city"`
+	XMLName      xml.Name `json:"-" xml:"response" csv:"-" msgpack:"-"`
+	Country      string   `json:"country" xml:"country" csv:"country" msgpack:"country"`
+	City         string   `json:"city" xml:"city" csv:"city" msgpack:"city"`
+	Network      string   `json:"network,omitempty" xml:"network,omitempty" csv:"network,omitempty" msgpack:"network,omitempty"`
+	PrefixLength *int     `json:"prefix_length,omitempty" xml:"prefix_length,omitempty" csv:"prefix_length,omitempty" msgpack:"prefix_length,omitempty"`
+	BuildDate    string   `json:"build_date,omitempty" xml:"build_date,omitempty" csv:"build_date,omitempty" msgpack:"build_date,omitempty"`
+	Source       string   `json:"source,omitempty" xml:"source,omitempty" csv:"source,omitempty" msgpack:"source,omitempty"`
 }
 
 func SetStore(s store.Store) {
@@ -33,12 +41,37 @@ func FindCountryHandler(w http.ResponseWriter, r *http.Request) {
 
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		slog.Error(fmt.Sprintf("Invalid IP address: %v", ipStr))
+		slog.ErrorContext(r.Context(), fmt.Sprintf("Invalid IP address: %v", ipStr))
 		middleware.WriteError(w, http.StatusBadRequest, "Invalid IP address")
 		return
 	}
 
-	info, err := storeImpl.GetInfoByIP(ip)
+	writeInfo(w, r, ip)
+}
+
+// WhoAmIHandler looks up the address of the caller itself, as resolved by middleware.ClientIPMiddleware.
+func WhoAmIHandler(w http.ResponseWriter, r *http.Request) {
+	ip := middleware.ClientIP(r)
+	if ip == nil {
+		slog.ErrorContext(r.Context(), fmt.Sprintf("Unable to determine client IP address from %v", r.RemoteAddr))
+		middleware.WriteError(w, http.StatusBadRequest, "Unable to determine client IP address")
+		return
+	}
+
+	writeInfo(w, r, ip)
+}
+
+func writeInfo(w http.ResponseWriter, r *http.Request, ip net.IP) {
+	f, err := negotiateFormat(r)
+	if errors.Is(err, errNotAcceptable) {
+		middleware.WriteError(w, http.StatusNotAcceptable, "Not Acceptable")
+		return
+	} else if err != nil {
+		middleware.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := stores.LookupContext(r.Context(), storeImpl, ip)
 	if err != nil && errors.Is(err, store.ErrNotFound) {
 		middleware.WriteError(w, http.StatusNotFound, err.Error())
 		return
@@ -50,6 +83,28 @@ func FindCountryHandler(w http.ResponseWriter, r *http.Request) {
 		Country: info.Country,
 		City:    info.City,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
+	if wantsDetails(r) {
+		addDetails(&resp, info)
+	}
+	writeResponse(w, f, resp)
+}
+
+// wantsDetails reports whether the caller asked for lookup metadata using the details query parameter
+func wantsDetails(r *http.Request) bool {
+	details, err := strconv.ParseBool(r.URL.Query().Get("details"))
+	return err == nil && details
+}
+
+func addDetails(resp *response, info *store.SubnetInfo) {
+	if _, network, err := net.ParseCIDR(info.Subnet); err == nil {
+		prefixLength, _ := network.Mask.Size()
+		resp.Network = network.String()
+		resp.PrefixLength = &prefixLength
+	}
+	if source, ok := storeImpl.(store.Source); ok {
+		resp.Source = source.Name()
+		if buildDate := source.BuildDate(); !buildDate.IsZero() {
+			resp.BuildDate = buildDate.Format(time.RFC3339)
+		}
+	}
 }
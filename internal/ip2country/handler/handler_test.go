@@ -1,14 +1,22 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/shamaton/msgpack/v2"
 
 	"ip2country/internal/ip2country/handler"
+	"ip2country/internal/logger"
 	"ip2country/pkg/store"
 )
 
@@ -21,6 +29,29 @@ func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
 	return m.info, m.err
 }
 
+type mockSourceStore struct {
+	mockStore
+	name      string
+	buildDate time.Time
+}
+
+func (m *mockSourceStore) Name() string {
+	return m.name
+}
+
+func (m *mockSourceStore) BuildDate() time.Time {
+	return m.buildDate
+}
+
+type mockCheckerStore struct {
+	mockStore
+	readyErr error
+}
+
+func (m *mockCheckerStore) Ready(_ context.Context) error {
+	return m.readyErr
+}
+
 func TestFindCountryHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -94,6 +125,221 @@ func TestFindCountryHandler(t *testing.T) {
 	}
 }
 
+func TestWhoAmIHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		storeInfo      *store.SubnetInfo
+		storeErr       error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Caller found",
+			remoteAddr:     "8.8.8.8:54321",
+			storeInfo:      &store.SubnetInfo{Country: "USA", City: "Mountain View"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"country":"USA","city":"Mountain View"}`,
+		},
+		{
+			name:           "Caller not found",
+			remoteAddr:     "127.0.0.1:54321",
+			storeErr:       store.ErrNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"not found"}`,
+		},
+		{
+			name:           "Unknown caller address",
+			remoteAddr:     "@",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Unable to determine client IP address"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.SetStore(&mockStore{
+				info: tt.storeInfo,
+				err:  tt.storeErr,
+			})
+
+			req, _ := http.NewRequest("GET", "/v1/me", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+
+			handler.WhoAmIHandler(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+
+			var responseBody map[string]string
+			_ = json.Unmarshal(rr.Body.Bytes(), &responseBody)
+			expectedBody := make(map[string]string)
+			_ = json.Unmarshal([]byte(tt.expectedBody), &expectedBody)
+
+			if !equal(responseBody, expectedBody) {
+				t.Errorf("handler returned unexpected body: got %v want %v", responseBody, expectedBody)
+			}
+		})
+	}
+}
+
+func TestFindCountryHandlerDetails(t *testing.T) {
+	handler.SetStore(&mockSourceStore{
+		mockStore: mockStore{info: &store.SubnetInfo{Subnet: "8.8.8.0/24", Country: "USA", City: "Mountain View"}},
+		name:      "local",
+		buildDate: time.Date(2024, 11, 18, 16, 49, 0, 0, time.UTC),
+	})
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedBody string
+	}{
+		{
+			name:         "Details not requested",
+			query:        "ip=8.8.8.8",
+			expectedBody: `{"country":"USA","city":"Mountain View"}`,
+		},
+		{
+			name:         "Details requested",
+			query:        "ip=8.8.8.8&details=true",
+			expectedBody: `{"country":"USA","city":"Mountain View","network":"8.8.8.0/24","prefix_length":24,"build_date":"2024-11-18T16:49:00Z","source":"local"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/v1/find-country?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			handler.FindCountryHandler(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+
+			var responseBody, expectedBody map[string]any
+			_ = json.Unmarshal(rr.Body.Bytes(), &responseBody)
+			_ = json.Unmarshal([]byte(tt.expectedBody), &expectedBody)
+			if !reflect.DeepEqual(responseBody, expectedBody) {
+				t.Errorf("handler returned unexpected body: got %v want %v", responseBody, expectedBody)
+			}
+		})
+	}
+}
+
+func TestFindCountryHandlerFormats(t *testing.T) {
+	handler.SetStore(&mockStore{info: &store.SubnetInfo{Country: "USA", City: "Mountain View"}})
+
+	tests := []struct {
+		name                string
+		query               string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "Default is JSON",
+			query:               "ip=8.8.8.8",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        "{\"country\":\"USA\",\"city\":\"Mountain View\"}\n",
+		},
+		{
+			name:                "Plain text from Accept header",
+			query:               "ip=8.8.8.8",
+			accept:              "text/plain",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "USA\n",
+		},
+		{
+			name:                "CSV from format parameter",
+			query:               "ip=8.8.8.8&format=csv",
+			accept:              "application/json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody:        "country,city,network,prefix_length,build_date,source\nUSA,Mountain View,,,,\n",
+		},
+		{
+			name:                "XML preferred by quality",
+			query:               "ip=8.8.8.8",
+			accept:              "application/json;q=0.5, application/xml",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/xml; charset=utf-8",
+			expectedBody:        xml.Header + "<response><country>USA</country><city>Mountain View</city></response>",
+		},
+		{
+			name:                "Wildcard Accept",
+			query:               "ip=8.8.8.8",
+			accept:              "text/html, */*;q=0.1",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        "{\"country\":\"USA\",\"city\":\"Mountain View\"}\n",
+		},
+		{
+			name:           "Unsupported Accept",
+			query:          "ip=8.8.8.8",
+			accept:         "image/png",
+			expectedStatus: http.StatusNotAcceptable,
+			expectedBody:   "{\"error\":\"Not Acceptable\"}\n",
+		},
+		{
+			name:           "Unknown format parameter",
+			query:          "ip=8.8.8.8&format=yaml",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "{\"error\":\"unknown format: yaml\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/v1/find-country?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.FindCountryHandler(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedContentType != "" && rr.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("handler returned wrong content type: got %v want %v", rr.Header().Get("Content-Type"), tt.expectedContentType)
+			}
+			if body := rr.Body.String(); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestFindCountryHandlerMessagePack(t *testing.T) {
+	handler.SetStore(&mockStore{info: &store.SubnetInfo{Country: "USA", City: "Mountain View"}})
+
+	req, _ := http.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	rr := httptest.NewRecorder()
+
+	handler.FindCountryHandler(rr, req)
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/msgpack" {
+		t.Errorf("handler returned wrong content type: got %v want %v", contentType, "application/msgpack")
+	}
+	var responseBody map[string]string
+	if err := msgpack.Unmarshal(rr.Body.Bytes(), &responseBody); err != nil {
+		t.Fatal(err)
+	}
+	expectedBody := map[string]string{"country": "USA", "city": "Mountain View"}
+	if !equal(responseBody, expectedBody) {
+		t.Errorf("handler returned unexpected body: got %v want %v", responseBody, expectedBody)
+	}
+}
+
 func equal(a, b map[string]string) bool {
 	if len(a) != len(b) {
 		return false
@@ -105,3 +351,95 @@ func equal(a, b map[string]string) bool {
 	}
 	return true
 }
+
+func TestHealthzHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	handler.HealthzHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		store          store.Store
+		expectedStatus int
+	}{
+		{
+			name:           "Ready store",
+			store:          &mockCheckerStore{},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Store not ready",
+			store:          &mockCheckerStore{readyErr: errors.New("database is not loaded")},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Store without readiness check",
+			store:          &mockStore{},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.SetStore(tt.store)
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/readyz", nil)
+			handler.ReadyzHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedLevel  string
+	}{
+		{name: "Current level", method: "GET", target: "/admin/log-level", expectedStatus: http.StatusOK, expectedLevel: "info"},
+		{name: "Level from body", method: "PUT", target: "/admin/log-level", body: `{"level":"debug"}`, expectedStatus: http.StatusOK, expectedLevel: "debug"},
+		{name: "Level from query", method: "POST", target: "/admin/log-level?level=WARN", expectedStatus: http.StatusOK, expectedLevel: "warn"},
+		{name: "Unknown level", method: "PUT", target: "/admin/log-level", body: `{"level":"verbose"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Missing level", method: "PUT", target: "/admin/log-level", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid body", method: "PUT", target: "/admin/log-level", body: `debug`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = logger.SetLevel("info")
+			defer func() { _ = logger.SetLevel("info") }()
+
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			handler.LogLevelHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedLevel == "" {
+				return
+			}
+			var resp struct{ Level string }
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Level != tt.expectedLevel {
+				t.Errorf("handler returned wrong level: got %v want %v", resp.Level, tt.expectedLevel)
+			}
+			if current := strings.ToLower(logger.Level().String()); current != tt.expectedLevel {
+				t.Errorf("Expected the logger to be at level %v, got %v", tt.expectedLevel, current)
+			}
+		})
+	}
+}
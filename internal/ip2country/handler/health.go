@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"ip2country/pkg/store"
+)
+
+// readinessTimeout bounds how long the store may take to report whether it is ready
+const readinessTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthzHandler reports that the process is alive and serving HTTP
+func HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// ReadyzHandler reports whether the store can serve lookups, with 503 while it cannot
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := Ready(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), fmt.Sprintf("Readiness check failed: %v", err))
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "not ready", Error: err.Error()})
+		return
+	}
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ready"})
+}
+
+// Ready returns why the store set with SetStore cannot serve lookups, or nil when it can
+func Ready(ctx context.Context) error {
+	if storeImpl == nil {
+		return fmt.Errorf("no data store")
+	}
+	checker, ok := storeImpl.(store.Checker)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	return checker.Ready(ctx)
+}
+
+func writeHealth(w http.ResponseWriter, statusCode int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(resp)
+}
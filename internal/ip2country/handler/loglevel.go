@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"ip2country/internal/logger"
+)
+
+type logLevelResponse struct {
+	Level string `json:"level,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// LogLevelHandler reports the current log level on GET, and changes it on PUT or POST.
+// The new level is read from the "level" query parameter or a JSON body such as {"level":"debug"}.
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeLogLevel(w, http.StatusOK, logLevelResponse{Level: strings.ToLower(logger.Level().String())})
+		return
+	}
+
+	requested := logLevelResponse{Level: r.URL.Query().Get("level")}
+	if requested.Level == "" {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&requested); err != nil {
+			writeLogLevel(w, http.StatusBadRequest, logLevelResponse{Error: "expected a level parameter or a JSON body with a level"})
+			return
+		}
+	}
+	if requested.Level == "" {
+		writeLogLevel(w, http.StatusBadRequest, logLevelResponse{Error: "level is required"})
+		return
+	}
+
+	previous := logger.Level()
+	if err := logger.SetLevel(requested.Level); err != nil {
+		writeLogLevel(w, http.StatusBadRequest, logLevelResponse{Error: err.Error()})
+		return
+	}
+	// Logged at warn so that the change is recorded whatever the new level is
+	slog.WarnContext(r.Context(), fmt.Sprintf("Log level changed from %s to %s", previous, logger.Level()))
+	writeLogLevel(w, http.StatusOK, logLevelResponse{Level: strings.ToLower(logger.Level().String())})
+}
+
+func writeLogLevel(w http.ResponseWriter, statusCode int, resp logLevelResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -1,39 +1,103 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
 
+	"ip2country/internal/config"
+	"ip2country/internal/metrics"
+	"ip2country/internal/tracing"
 	"ip2country/pkg/store"
 )
 
 type APIStore struct {
-	host string
+	host   atomic.Pointer[string]
+	client *http.Client
 }
 
 func NewAPIStore(host string) *APIStore {
-	return &APIStore{host: host}
+	s := &APIStore{
+		client: &http.Client{Transport: tracing.Transport(metrics.InstrumentTransport(http.DefaultTransport))},
+	}
+	s.SetHost(host)
+	return s
+}
+
+// SetHost points the store at another upstream, lookups in flight complete with the previous one
+func (r *APIStore) SetHost(host string) {
+	r.host.Store(&host)
+}
+
+func (r *APIStore) Name() string {
+	return string(config.API)
+}
+
+// BuildDate is unknown for the API, the provider manages its own data
+func (r *APIStore) BuildDate() time.Time {
+	return time.Time{}
+}
+
+// Close drops the idle connections to the upstream
+func (r *APIStore) Close() {
+	r.client.CloseIdleConnections()
+}
+
+// Ready reports whether the upstream answers at all. Any HTTP response counts, only connection failures do not.
+func (r *APIStore) Ready(ctx context.Context) error {
+	host := *r.host.Load()
+	upstream, err := url.Parse(host)
+	if err != nil {
+		// The parse error quotes the host, which may hold an API key
+		return fmt.Errorf("invalid API host: %w", errors.Unwrap(err))
+	}
+	upstream.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, upstream.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "keycdn-tools:https://www.github.com")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API upstream is unreachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
 }
 
 func (r *APIStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	return r.GetInfoByIPContext(context.Background(), ip)
+}
 
-	client := &http.Client{}
-	host := fmt.Sprintf("%s=%s", r.host, ip.String())
-	slog.Info(fmt.Sprintf("Requesting data from the API: %s", host))
-	req, err := http.NewRequest("GET", host, nil)
+// GetInfoByIPContext requests ip from the upstream as part of ctx, propagating its trace to the upstream
+func (r *APIStore) GetInfoByIPContext(ctx context.Context, ip net.IP) (*store.SubnetInfo, error) {
+	base := *r.host.Load()
+	host := fmt.Sprintf("%s=%s", base, ip.String())
+	slog.InfoContext(ctx, fmt.Sprintf("Requesting data from the API: %s for %s", config.RedactURL(base), ip))
+	req, err := http.NewRequestWithContext(ctx, "GET", host, nil)
 	if err != nil {
-		return nil, err
+		// The parse error quotes the host, which may hold an API key
+		return nil, fmt.Errorf("invalid API host: %w", errors.Unwrap(err))
 	}
 
 	req.Header.Set("User-Agent", "keycdn-tools:https://www.github.com")
 
-	resp, err := client.Do(req)
+	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, err
+		// The error of the client quotes the whole URL, its query included, and ends up in responses and spans
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("request to %s failed: %w", config.RedactURL(base), err)
 	}
 	defer resp.Body.Close()
 
@@ -47,6 +111,7 @@ func (r *APIStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
 		Data        struct {
 			Geo struct {
 				CountryName string `json:"country_name"`
+				CountryCode string `json:"country_code"`
 				City        string `json:"city"`
 			} `json:"geo"`
 		} `json:"data"`
@@ -61,8 +126,9 @@ func (r *APIStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
 	}
 
 	return &store.SubnetInfo{
-		Subnet:  ip.String(),
-		Country: result.Data.Geo.CountryName,
-		City:    result.Data.Geo.City,
+		Subnet:      ip.String(),
+		Country:     result.Data.Geo.CountryName,
+		City:        result.Data.Geo.City,
+		CountryCode: result.Data.Geo.CountryCode,
 	}, nil
 }
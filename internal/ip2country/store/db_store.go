@@ -1,9 +1,12 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"net"
+	"time"
 
+	"ip2country/internal/config"
 	"ip2country/pkg/store"
 )
 
@@ -14,6 +17,18 @@ func NewDBStore() *DBStore {
 	return &DBStore{}
 }
 
+func (r *DBStore) Name() string {
+	return string(config.Relational)
+}
+
+func (r *DBStore) BuildDate() time.Time {
+	return time.Time{}
+}
+
+func (r *DBStore) Ready(_ context.Context) error {
+	return errors.New("not implemented")
+}
+
 func (r *DBStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
 	_ = ip
 	return nil, errors.New("not implemented")
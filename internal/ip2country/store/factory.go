@@ -15,11 +15,10 @@ func NewStore(cfg *config.Config, cmd *cobra.Command) (store2.Store, error) {
 	case config.API:
 		slog.Info("Using API data store")
 		// Initialize and return the API store implementation
-		for i, db := range cfg.DB {
-			if db.Name == config.API {
-				return NewAPIStore(cfg.DB[i].Host), nil
-			}
+		if host, ok := apiHost(cfg); ok {
+			return NewAPIStore(host), nil
 		}
+		return nil, fmt.Errorf("no db entry named %s", config.API)
 
 	case config.Relational:
 		slog.Info("Using some relational database data store")
@@ -34,5 +33,25 @@ func NewStore(cfg *config.Config, cmd *cobra.Command) (store2.Store, error) {
 	default:
 		return nil, fmt.Errorf("unknown data store type: %s", cfg.ActiveDataStore)
 	}
-	return nil, fmt.Errorf("unknown data store type: %s", cfg.ActiveDataStore)
+}
+
+// Reconfigure applies the settings of cfg that can change while s serves lookups: the upstream of the API store
+func Reconfigure(s store2.Store, cfg *config.Config) {
+	api, ok := s.(*APIStore)
+	if !ok {
+		return
+	}
+	if host, ok := apiHost(cfg); ok {
+		api.SetHost(host)
+	}
+}
+
+// apiHost returns the host of the db entry named api
+func apiHost(cfg *config.Config) (string, bool) {
+	for _, db := range cfg.DB {
+		if db.Name == config.API {
+			return db.Host, true
+		}
+	}
+	return "", false
 }
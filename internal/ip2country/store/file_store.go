@@ -1,20 +1,25 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"path/filepath"
+	"time"
 
 	"github.com/yl2chen/cidranger"
 
+	"ip2country/internal/config"
 	"ip2country/internal/dbgenerator"
 	"ip2country/pkg/store"
 )
 
 type FileStore struct {
-	tree cidranger.Ranger
+	tree      cidranger.Ranger
+	buildDate time.Time
+	records   int
 }
 
 func NewFileStore(zipPath string) *FileStore {
@@ -24,7 +29,7 @@ func NewFileStore(zipPath string) *FileStore {
 	dataPath := filepath.Dir(zipPath) + "/geodata.dat"
 	tree, err := generator.TryLoadFromGob(dataPath)
 	if tree != nil {
-		return &FileStore{tree: tree}
+		return &FileStore{tree: tree, buildDate: generator.BuildDate(), records: len(generator.Entries())}
 	}
 	tree, err = generator.DirectFromZip(zipPath)
 	if err != nil {
@@ -34,23 +39,67 @@ func NewFileStore(zipPath string) *FileStore {
 	if err != nil {
 		slog.Error(fmt.Sprintf("Error saving file store: %v", err))
 	}
-	return &FileStore{tree: tree}
+	return &FileStore{tree: tree, buildDate: generator.BuildDate(), records: len(generator.Entries())}
 
 }
 
+// OpenFileStore opens the database at path, a GeoLite2 zip or a geodata.dat file, without saving a geodata.dat next to it
+func OpenFileStore(path string) (*FileStore, error) {
+	generator := dbgenerator.NewDbGenerator()
+	defer generator.Close()
+	if err := generator.Load(path); err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	if err := generator.BuildCIDRTree(); err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	return &FileStore{tree: generator.Tree(), buildDate: generator.BuildDate(), records: len(generator.Entries())}, nil
+}
+
+func (r *FileStore) Name() string {
+	return string(config.Local)
+}
+
+func (r *FileStore) BuildDate() time.Time {
+	return r.buildDate
+}
+
+func (r *FileStore) RecordCount() int {
+	if r.tree == nil {
+		return 0
+	}
+	return r.records
+}
+
+// Ready reports whether the database was loaded and holds any networks
+func (r *FileStore) Ready(_ context.Context) error {
+	if r.tree == nil {
+		return errors.New("database is not loaded")
+	}
+	if r.records == 0 {
+		return errors.New("database is empty")
+	}
+	return nil
+}
+
 func (r *FileStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	return r.GetInfoByIPContext(context.Background(), ip)
+}
+
+// GetInfoByIPContext looks ip up in the database, logging problems with the request of ctx
+func (r *FileStore) GetInfoByIPContext(ctx context.Context, ip net.IP) (*store.SubnetInfo, error) {
 	if r.tree == nil {
 		return nil, errors.New("tree is nil")
 	}
 
 	if ip == nil {
-		slog.Error(fmt.Sprintf("Invalid IP address: %v", ip))
+		slog.ErrorContext(ctx, fmt.Sprintf("Invalid IP address: %v", ip))
 		return nil, errors.New("invalid IP address")
 	}
 
 	entries, err := r.tree.ContainingNetworks(ip)
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error finding IP: %v", err))
+		slog.ErrorContext(ctx, fmt.Sprintf("Error finding IP: %v", err))
 		return nil, err
 	}
 	if len(entries) == 0 {
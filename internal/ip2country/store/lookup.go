@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"ip2country/internal/metrics"
+	"ip2country/internal/tracing"
+	"ip2country/pkg/store"
+)
+
+// Lookup resolves ip with s and records the latency and result of the lookup
+func Lookup(s store.Store, ip net.IP) (*store.SubnetInfo, error) {
+	return LookupContext(context.Background(), s, ip)
+}
+
+// LookupContext is Lookup as part of the request of ctx. The lookup is traced as a span of that request, and
+// stores implementing store.ContextStore receive ctx.
+func LookupContext(ctx context.Context, s store.Store, ip net.IP) (*store.SubnetInfo, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "store.lookup", trace.WithAttributes(attribute.String("store", Name(s))))
+	defer span.End()
+
+	start := time.Now()
+	var info *store.SubnetInfo
+	var err error
+	if contextStore, ok := s.(store.ContextStore); ok {
+		info, err = contextStore.GetInfoByIPContext(ctx, ip)
+	} else {
+		info, err = s.GetInfoByIP(ip)
+	}
+
+	result := metrics.ResultFound
+	if errors.Is(err, store.ErrNotFound) {
+		result = metrics.ResultNotFound
+	} else if err != nil {
+		result = metrics.ResultError
+	}
+	metrics.ObserveLookup(Name(s), result, time.Since(start))
+	span.SetAttributes(attribute.String("result", result))
+	if result == metrics.ResultError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return info, err
+}
+
+// Name returns the type of a data store, "unknown" when it does not describe itself
+func Name(s store.Store) string {
+	if source, ok := s.(store.Source); ok {
+		return source.Name()
+	}
+	return "unknown"
+}
+
+// Close releases the resources of s, if it holds any
+func Close(s store.Store) {
+	if closer, ok := s.(store.Closer); ok {
+		closer.Close()
+	}
+}
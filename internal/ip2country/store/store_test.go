@@ -1,12 +1,21 @@
 package store_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"ip2country/internal/config"
+	"ip2country/internal/dbgenerator"
 	sut "ip2country/internal/ip2country/store"
+	"ip2country/internal/logger"
 	"ip2country/pkg/store"
 )
 
@@ -66,6 +75,32 @@ func TestFileStore_GetInfoByIP(t *testing.T) {
 	}
 }
 
+func TestFileStore_GetInfoByIPContextLogsRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logger.NewContextHandler(slog.NewTextHandler(&logs, nil))))
+	defer slog.SetDefault(previous)
+
+	fs := sut.NewFileStore("geolite2-test.zip")
+	ctx := logger.WithRequestID(context.Background(), "req-42")
+	if _, err := fs.GetInfoByIPContext(ctx, nil); err == nil {
+		t.Fatal("Expected an error for a missing IP")
+	}
+	if !strings.Contains(logs.String(), "req-42") {
+		t.Errorf("Expected the error log to carry the request ID, got %q", logs.String())
+	}
+}
+
+func TestFileStore_Source(t *testing.T) {
+	fs := sut.NewFileStore("geolite2-test.zip")
+	if name := fs.Name(); name != "local" {
+		t.Errorf("Expected name local, got %v", name)
+	}
+	if fs.BuildDate().IsZero() {
+		t.Error("Expected a build date from the zip file")
+	}
+}
+
 func TestFileStore_Close(t *testing.T) {
 	fs := sut.NewFileStore("geolite2-test.zip")
 	fs.Close()
@@ -116,3 +151,121 @@ func TestAPIStore_GetInfoByIP(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIStore_UpstreamErrorHidesKey(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+	api := sut.NewAPIStore(upstream.URL + "/json/?key=s3cr3t-api-key&host")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"unreachable upstream", context.Background()},
+		{"canceled lookup", canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := api.GetInfoByIPContext(tt.ctx, net.ParseIP("8.8.8.8"))
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if strings.Contains(err.Error(), "s3cr3t-api-key") {
+				t.Errorf("Expected the API key to be redacted, got %v", err)
+			}
+			if tt.ctx.Err() != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected the cancellation to be kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStore_Ready(t *testing.T) {
+	fs := sut.NewFileStore("geolite2-test.zip")
+	if err := fs.Ready(context.Background()); err != nil {
+		t.Errorf("Expected loaded store to be ready, got %v", err)
+	}
+
+	missing := sut.NewFileStore(filepath.Join(t.TempDir(), "missing.zip"))
+	if err := missing.Ready(context.Background()); err == nil {
+		t.Error("Expected store without a database not to be ready")
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	var requested string
+	upstream := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = name
+			_, _ = w.Write([]byte(`{"status":"success","data":{"geo":{"country_name":"Israel"}}}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	first, second := upstream("first"), upstream("second")
+
+	api := sut.NewAPIStore(first.URL + "/?host")
+	apiConfig := func(host string) *config.Config {
+		return &config.Config{DB: []config.DBConfig{{Name: config.Local, Host: "db/geolite2.zip"}, {Name: config.API, Host: host}}}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		cfg      *config.Config
+		expected string
+	}{
+		{name: "Initial upstream", cfg: apiConfig(first.URL + "/?host"), expected: "first"},
+		{name: "Reloaded upstream", cfg: apiConfig(second.URL + "/?host"), expected: "second"},
+		{name: "No API entry keeps the upstream", cfg: &config.Config{}, expected: "second"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sut.Reconfigure(api, tt.cfg)
+			if _, err := api.GetInfoByIP(net.ParseIP("1.2.3.4")); err != nil {
+				t.Fatal(err)
+			}
+			if requested != tt.expected {
+				t.Errorf("Expected the %s upstream to be requested, got %s", tt.expected, requested)
+			}
+		})
+	}
+}
+
+func TestOpenFileStore(t *testing.T) {
+	fromZip, err := sut.OpenFileStore("geolite2-test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := filepath.Join(t.TempDir(), "geodata.dat")
+	generator := dbgenerator.NewDbGenerator()
+	if err := generator.Load("geolite2-test.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := generator.SaveInfo(saved); err != nil {
+		t.Fatal(err)
+	}
+	fromDat, err := sut.OpenFileStore(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fs := range map[string]*sut.FileStore{"zip": fromZip, "dat": fromDat} {
+		t.Run(name, func(t *testing.T) {
+			info, err := fs.GetInfoByIP(net.ParseIP("8.8.8.8"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.CountryCode != "US" || info.Subnet != "8.8.8.0/23" {
+				t.Errorf("Expected 8.8.8.0/23 in the US, got %+v", info)
+			}
+			if fs.RecordCount() != len(generator.Entries()) {
+				t.Errorf("Expected %d records, got %d", len(generator.Entries()), fs.RecordCount())
+			}
+		})
+	}
+
+	if _, err := sut.OpenFileStore(filepath.Join(t.TempDir(), "missing.zip")); err == nil {
+		t.Error("Expected an error for a missing database")
+	}
+}
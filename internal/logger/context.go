@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// WithRequestID returns a copy of ctx carrying the ID of the request being served
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the request being served, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewContextHandler wraps h to add the request ID of the context to every record
+func NewContextHandler(h slog.Handler) slog.Handler {
+	return contextHandler{h}
+}
+
+// contextHandler adds the request ID of the context to every record logged with one, e.g. with slog.InfoContext
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(string(requestIDKey), id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
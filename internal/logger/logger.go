@@ -1,26 +1,137 @@
+// Package logger Description: This package contains the logging setup of the ip2country service.
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/lmittmann/tint"
+	"gopkg.in/natefinch/lumberjack.v2"
 
 	"ip2country/internal/config"
 )
 
-func InitLogger(cnf *config.Config) {
-	options := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+// level is shared by every handler, so changing it applies to loggers already created
+var level = new(slog.LevelVar)
+
+// closer releases the log file, if logs are written to one
+var closer io.Closer
+
+// InitLogger installs the default logger with the level, format and output of the configuration
+func InitLogger(cnf *config.Config) error {
+	if err := SetLevel(ConfiguredLevel(cnf)); err != nil {
+		return err
+	}
+
+	out, err := output(cnf.Logger)
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(cnf, out)
+	if err != nil {
+		return err
+	}
+
+	logger := slog.New(NewContextHandler(handler))
+	if !cnf.IsDebug {
+		logger = logger.With(
+			slog.String("service_name", cnf.Logger.ServiceName),
+			slog.String("service_version", cnf.Logger.ServiceVersion),
+		)
+	}
+
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Close closes the log file, if logs are written to one
+func Close() {
+	if closer != nil {
+		_ = closer.Close()
+		closer = nil
+	}
+}
+
+// ConfiguredLevel returns the level set by logger.level. Without one, debug mode logs at debug and other modes at info.
+func ConfiguredLevel(cnf *config.Config) string {
+	if cnf.Logger.Level == "" && cnf.IsDebug {
+		return slog.LevelDebug.String()
 	}
+	return cnf.Logger.Level
+}
+
+// Level returns the current minimum level of logs
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the minimum level of logs, e.g. "debug" or "warn". An empty level means info.
+func SetLevel(name string) error {
+	if name == "" {
+		level.Set(slog.LevelInfo)
+		return nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// output opens the destination of logs. Log files are rotated by size and age.
+func output(cnf config.LoggerConfig) (io.Writer, error) {
+	switch cnf.Output {
+	case config.LogOutputStdout, "":
+		return os.Stdout, nil
+	case config.LogOutputStderr:
+		return os.Stderr, nil
+	case config.LogOutputFile:
+		if cnf.File.Path == "" {
+			return nil, fmt.Errorf("a log file path is required for the %s output", config.LogOutputFile)
+		}
+		file := &lumberjack.Logger{
+			Filename:   cnf.File.Path,
+			MaxSize:    cnf.File.MaxSizeMB,
+			MaxAge:     cnf.File.MaxAgeDays,
+			MaxBackups: cnf.File.MaxBackups,
+			Compress:   cnf.File.Compress,
+			LocalTime:  true,
+		}
+		Close()
+		closer = file
+		return file, nil
+	default:
+		return nil, fmt.Errorf("unknown log output: %s", cnf.Output)
+	}
+}
 
-	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, options)
-	if cnf.IsDebug {
-		options.Level = slog.LevelDebug
-		handler = tint.NewHandler(os.Stdout, &tint.Options{
-			Level:      options.Level,
+// newHandler creates the handler of the configured format. Without one, logs are JSON, or tint when debugging.
+func newHandler(cnf *config.Config, out io.Writer) (slog.Handler, error) {
+	format := strings.ToLower(cnf.Logger.Format)
+	if format == "" {
+		format = config.LogFormatJSON
+		if cnf.IsDebug {
+			format = config.LogFormatTint
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case config.LogFormatJSON:
+		return slog.NewJSONHandler(out, options), nil
+	case config.LogFormatText:
+		return slog.NewTextHandler(out, options), nil
+	case config.LogFormatTint:
+		return tint.NewHandler(out, &tint.Options{
+			Level:      level,
 			TimeFormat: time.Kitchen,
+			// Colors are only readable on a terminal
+			NoColor: cnf.Logger.Output == config.LogOutputFile,
 			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
 				if err, ok := a.Value.Any().(error); ok {
 					aErr := tint.Err(err)
@@ -29,15 +140,8 @@ func InitLogger(cnf *config.Config) {
 				}
 				return a
 			},
-		})
-	}
-	logger := slog.New(handler)
-	if !cnf.IsDebug {
-		logger = logger.With(
-			slog.String("service_name", cnf.Logger.ServiceName),
-			slog.String("service_version", cnf.Logger.ServiceVersion),
-		)
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", cnf.Logger.Format)
 	}
-
-	slog.SetDefault(logger)
 }
@@ -0,0 +1,109 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip2country/internal/config"
+	sut "ip2country/internal/logger"
+)
+
+func TestInitLoggerLevel(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		expectedLevel slog.Level
+		expectedErr   bool
+	}{
+		{name: "Default level", expectedLevel: slog.LevelInfo},
+		{name: "Configured level", cfg: config.Config{Logger: config.LoggerConfig{Level: "warn"}}, expectedLevel: slog.LevelWarn},
+		{name: "Debug mode", cfg: config.Config{IsDebug: true}, expectedLevel: slog.LevelDebug},
+		{name: "Configured level in debug mode", cfg: config.Config{IsDebug: true, Logger: config.LoggerConfig{Level: "info"}}, expectedLevel: slog.LevelInfo},
+		{name: "Unknown level", cfg: config.Config{Logger: config.LoggerConfig{Level: "verbose"}}, expectedErr: true},
+		{name: "Unknown format", cfg: config.Config{Logger: config.LoggerConfig{Format: "xml"}}, expectedErr: true},
+		{name: "Unknown output", cfg: config.Config{Logger: config.LoggerConfig{Output: "syslog"}}, expectedErr: true},
+		{name: "File output without path", cfg: config.Config{Logger: config.LoggerConfig{Output: config.LogOutputFile}}, expectedErr: true},
+	}
+
+	defer slog.SetDefault(slog.Default())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sut.InitLogger(&tt.cfg)
+			if tt.expectedErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level := sut.Level(); level != tt.expectedLevel {
+				t.Errorf("Expected level %v, got %v", tt.expectedLevel, level)
+			}
+		})
+	}
+}
+
+func TestInitLoggerFileOutput(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	path := filepath.Join(t.TempDir(), "ip2country.log")
+	cfg := &config.Config{Logger: config.LoggerConfig{
+		Level:  "info",
+		Format: config.LogFormatJSON,
+		Output: config.LogOutputFile,
+		File:   config.LogFileConfig{Path: path, MaxSizeMB: 1},
+	}}
+	if err := sut.InitLogger(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	slog.Debug("hidden")
+	slog.Info("visible")
+	// Changing the level applies to the logger already installed
+	if err := sut.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("now visible")
+	sut.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record struct{ Msg string }
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON records, got %q", line)
+		}
+		messages = append(messages, record.Msg)
+	}
+	if strings.Join(messages, ",") != "visible,now visible" {
+		t.Errorf("Expected the records visible and now visible, got %v", messages)
+	}
+}
+
+func TestInitLoggerTextFormat(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	path := filepath.Join(t.TempDir(), "ip2country.log")
+	cfg := &config.Config{Logger: config.LoggerConfig{
+		Format: config.LogFormatText,
+		Output: config.LogOutputFile,
+		File:   config.LogFileConfig{Path: path},
+	}}
+	if err := sut.InitLogger(cfg); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("hello")
+	sut.Close()
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "msg=hello") {
+		t.Errorf("Expected a text record, got %q", data)
+	}
+}
@@ -0,0 +1,183 @@
+// Package metrics Description: This package contains the Prometheus metrics of the ip2country service.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"ip2country/pkg/store"
+)
+
+const namespace = "ip2country"
+
+const (
+	ResultFound    = "found"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+)
+
+// currentStore is the store whose database is described by the database gauges
+var currentStore atomic.Pointer[store.Store]
+
+// Registry holds every metric of the service along with the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter, by the kind of client key.",
+	}, []string{"key"})
+
+	lookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_lookups_total",
+		Help:      "Store lookups by store type and result (found, not_found or error).",
+	}, []string{"store", "result"})
+
+	lookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_lookup_duration_seconds",
+		Help:      "Store lookup latency by store type.",
+		Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"store"})
+
+	upstreamResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_upstream_responses_total",
+		Help:      "Responses of the API store upstream by status code, \"error\" when no response was received.",
+	}, []string{"code"})
+
+	databaseRecords = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_records",
+		Help:      "Number of networks in the database of the active store, 0 when unknown.",
+	}, func() float64 {
+		if s := currentStore.Load(); s != nil {
+			if counter, ok := (*s).(store.RecordCounter); ok {
+				return float64(counter.RecordCount())
+			}
+		}
+		return 0
+	})
+
+	databaseBuildTimestamp = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_build_timestamp_seconds",
+		Help:      "Unix time the database of the active store was built, 0 when unknown.",
+	}, func() float64 {
+		if s := currentStore.Load(); s != nil {
+			if source, ok := (*s).(store.Source); ok && !source.BuildDate().IsZero() {
+				return float64(source.BuildDate().Unix())
+			}
+		}
+		return 0
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		rateLimitRejections,
+		lookupsTotal,
+		lookupDuration,
+		upstreamResponses,
+		databaseRecords,
+		databaseBuildTimestamp,
+	)
+}
+
+// SetStore selects the store described by the database gauges
+func SetStore(s store.Store) {
+	currentStore.Store(&s)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware counts requests and observes their latency by route template, so path parameters do not explode the labels
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rr := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rr, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		status := strconv.Itoa(rr.statusCode)
+		requestsTotal.WithLabelValues(route, r.Method, status).Inc()
+		requestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RateLimitRejected counts a request rejected by the rate limiter
+func RateLimitRejected(keyKind string) {
+	rateLimitRejections.WithLabelValues(keyKind).Inc()
+}
+
+// ObserveLookup records the latency and result of a store lookup
+func ObserveLookup(storeType, result string, duration time.Duration) {
+	lookupsTotal.WithLabelValues(storeType, result).Inc()
+	lookupDuration.WithLabelValues(storeType).Observe(duration.Seconds())
+}
+
+// InstrumentTransport counts the upstream responses of an http.Client by status code
+func InstrumentTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			upstreamResponses.WithLabelValues("error").Inc()
+			return nil, err
+		}
+		upstreamResponses.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (rr *statusRecorder) WriteHeader(code int) {
+	rr.statusCode = code
+	rr.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,95 @@
+package metrics_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	sut "ip2country/internal/metrics"
+	"ip2country/pkg/store"
+)
+
+type mockStore struct{}
+
+func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	return nil, store.ErrNotFound
+}
+
+func (m *mockStore) Name() string {
+	return "local"
+}
+
+func (m *mockStore) BuildDate() time.Time {
+	return time.Unix(1731948540, 0)
+}
+
+func (m *mockStore) RecordCount() int {
+	return 42
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	sut.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("metrics handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	return rr.Body.String()
+}
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(sut.Middleware)
+	r.HandleFunc("/v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, id := range []string{"1", "2"} {
+		req, _ := http.NewRequest("GET", "/v1/items/"+id, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	expected := `ip2country_http_requests_total{method="GET",route="/v1/items/{id}",status="418"} 2`
+	if body := scrape(t); !strings.Contains(body, expected) {
+		t.Errorf("Expected metrics to contain %s", expected)
+	}
+}
+
+func TestDatabaseGauges(t *testing.T) {
+	sut.SetStore(&mockStore{})
+
+	body := scrape(t)
+	for _, expected := range []string{
+		"ip2country_database_records 42",
+		"ip2country_database_build_timestamp_seconds 1.73194854e+09",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %s", expected)
+		}
+	}
+}
+
+func TestInstrumentTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: sut.InstrumentTransport(nil)}
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	expected := `ip2country_api_upstream_responses_total{code="503"} 1`
+	if body := scrape(t); !strings.Contains(body, expected) {
+		t.Errorf("Expected metrics to contain %s", expected)
+	}
+}
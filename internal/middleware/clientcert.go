@@ -0,0 +1,12 @@
+package middleware
+
+import "net/http"
+
+// ClientSubject returns the subject of the client certificate verified during the TLS handshake, e.g.
+// "CN=team-a,O=Example". It is empty for plain HTTP and for connections without a verified certificate.
+func ClientSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"ip2country/internal/config"
+)
+
+type contextKey string
+
+const clientIPKey contextKey = "client_ip"
+
+// ClientIPMiddleware resolves the address of the caller and stores it in the request context.
+// Forwarding headers are only honored when the immediate peer is one of the configured trusted proxies.
+func ClientIPMiddleware(cfg *config.Config, next http.Handler) http.Handler {
+	return NewTrustedProxies(cfg.TrustedProxies).Middleware(next)
+}
+
+// TrustedProxies are the proxies whose forwarding headers are honored. They can be replaced while serving.
+type TrustedProxies struct {
+	networks atomic.Pointer[[]*net.IPNet]
+}
+
+func NewTrustedProxies(entries []string) *TrustedProxies {
+	p := &TrustedProxies{}
+	p.Set(entries)
+	return p
+}
+
+// Set replaces the trusted proxies with entries, CIDRs or single addresses
+func (p *TrustedProxies) Set(entries []string) {
+	networks := ParseTrustedProxies(entries)
+	p.networks.Store(&networks)
+}
+
+// Middleware resolves the address of the caller, like ClientIPMiddleware, with the current trusted proxies
+func (p *TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := resolveClientIP(r, *p.networks.Load())
+		ctx := context.WithValue(r.Context(), clientIPKey, ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP returns the caller address resolved by ClientIPMiddleware, falling back to the request's RemoteAddr.
+func ClientIP(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(clientIPKey).(net.IP); ok {
+		return ip
+	}
+	return parseHostIP(r.RemoteAddr)
+}
+
+// ParseTrustedProxies converts a list of CIDRs or single addresses to networks. Invalid entries are logged and skipped.
+func ParseTrustedProxies(entries []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				slog.Error(fmt.Sprintf("Invalid trusted proxy %s", entry))
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Invalid trusted proxy %s: %v", entry, err))
+			continue
+		}
+		networks = append(networks, ipNet)
+	}
+	return networks
+}
+
+func resolveClientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	peer := parseHostIP(r.RemoteAddr)
+	if peer == nil || !isTrusted(peer, trusted) {
+		return peer
+	}
+
+	chain := forwardedFor(r.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		chain = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	if len(chain) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			chain = []net.IP{ip}
+		}
+	}
+	if len(chain) == 0 {
+		return peer
+	}
+
+	// Walk the chain from the closest hop outwards and stop at the first address we do not trust.
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] == nil {
+			// An unknown or obfuscated hop breaks the chain, the last known hop is the best we can do
+			if i == len(chain)-1 {
+				return peer
+			}
+			return chain[i+1]
+		}
+		if !isTrusted(chain[i], trusted) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers in hop order.
+func forwardedFor(values []string) []net.IP {
+	var chain []net.IP
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				chain = append(chain, parseHostIP(strings.Trim(val, `"`)))
+			}
+		}
+	}
+	return chain
+}
+
+func xForwardedFor(values []string) []net.IP {
+	var chain []net.IP
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hop = strings.TrimSpace(hop)
+			if hop == "" {
+				continue
+			}
+			chain = append(chain, parseHostIP(hop))
+		}
+	}
+	return chain
+}
+
+// parseHostIP parses an address that may carry a port, such as "1.2.3.4:80" or "[::1]:80".
+func parseHostIP(addr string) net.IP {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	}
+	return net.ParseIP(host)
+}
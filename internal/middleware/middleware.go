@@ -3,53 +3,17 @@ package middleware
 
 import (
 	"encoding/json"
-	"fmt"
 	"log/slog"
 	"net/http"
-	"sync"
 	"time"
 
 	"ip2country/internal/config"
 )
 
-var (
-	tokens        int
-	lastTokenTime = time.Now()
-	mu            sync.Mutex
-	once          sync.Once
-)
-
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-func RateLimitMiddleware(cfg *config.Config, next http.Handler) http.Handler {
-	once.Do(func() {
-		tokens = cfg.BurstLimit
-	})
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		mu.Lock()
-		defer mu.Unlock()
-
-		now := time.Now()
-		elapsed := now.Sub(lastTokenTime).Seconds()
-		tokens += int(elapsed * float64(cfg.RateLimit))
-		if tokens > cfg.BurstLimit {
-			tokens = cfg.BurstLimit
-		}
-		lastTokenTime = now
-
-		if tokens > 0 {
-			tokens--
-			slog.Info(fmt.Sprintf("Rate Limiting tokens remaining: %d", tokens))
-			next.ServeHTTP(w, r)
-		} else {
-			slog.Warn("Rate Limiting: Too Many Requests")
-			WriteError(w, http.StatusTooManyRequests, "Too Many Requests")
-		}
-	})
-}
-
 func ErrorHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -67,25 +31,101 @@ func WriteError(w http.ResponseWriter, statusCode int, errMsg string) {
 	json.NewEncoder(w).Encode(ErrorResponse{Error: errMsg})
 }
 
+// LoggingMiddleware logs an access log entry with the default fields for every request
 func LoggingMiddleware(next http.Handler) http.Handler {
+	return AccessLogMiddleware(config.DefaultAccessLogFields, next)
+}
+
+// accessLogFields renders each field that can be selected with ACCESS_LOG_FIELDS
+var accessLogFields = map[string]func(r *http.Request, rr *responseRecorder, elapsed time.Duration) slog.Attr{
+	"method": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.String("method", r.Method)
+	},
+	"path": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.String("path", r.URL.Path)
+	},
+	"query": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		// API keys may be sent as a parameter
+		return slog.String("query", config.RedactQuery(r.URL.RawQuery, APIKeyParam))
+	},
+	"host": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.String("host", r.Host)
+	},
+	"protocol": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.String("protocol", r.Proto)
+	},
+	"user_agent": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.String("user_agent", r.UserAgent())
+	},
+	"referer": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.String("referer", r.Referer())
+	},
+	"status": func(_ *http.Request, rr *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.Int("status", rr.statusCode)
+	},
+	"bytes": func(_ *http.Request, rr *responseRecorder, _ time.Duration) slog.Attr {
+		return slog.Int("bytes", rr.bytes)
+	},
+	"duration": func(_ *http.Request, _ *responseRecorder, elapsed time.Duration) slog.Attr {
+		return slog.Duration("duration", elapsed)
+	},
+	"client_ip": func(r *http.Request, _ *responseRecorder, _ time.Duration) slog.Attr {
+		if ip := ClientIP(r); ip != nil {
+			return slog.String("client_ip", ip.String())
+		}
+		return slog.String("client_ip", r.RemoteAddr)
+	},
+}
+
+// AccessLogMiddleware logs one structured "access" entry per request with the given fields, see accessLogFields.
+// The request ID is added by the logger from the request context. Unknown fields are skipped, and the default
+// fields are logged when none are given.
+func AccessLogMiddleware(fields []string, next http.Handler) http.Handler {
+	if len(fields) == 0 {
+		fields = config.DefaultAccessLogFields
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		slog.Info(fmt.Sprintf("Started %s %s", r.Method, r.URL.Path))
 
-		// Create a response writer to capture the status code
-		rr := &responseRecorder{w, http.StatusOK}
+		// Create a response writer to capture the status code and size
+		rr := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(rr, r)
 
-		slog.Info(fmt.Sprintf("Completed %s %s in %v with status %d", r.Method, r.URL.Path, time.Since(start), rr.statusCode))
+		elapsed := time.Since(start)
+		attrs := make([]slog.Attr, 0, len(fields))
+		for _, field := range fields {
+			if attr, ok := accessLogFields[field]; ok {
+				attrs = append(attrs, attr(r, rr, elapsed))
+			}
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "access", attrs...)
 	})
 }
 
+// UnknownAccessLogFields returns the fields that AccessLogMiddleware cannot log
+func UnknownAccessLogFields(fields []string) []string {
+	var unknown []string
+	for _, field := range fields {
+		if _, ok := accessLogFields[field]; !ok {
+			unknown = append(unknown, field)
+		}
+	}
+	return unknown
+}
+
 type responseRecorder struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 func (rr *responseRecorder) WriteHeader(code int) {
 	rr.statusCode = code
 	rr.ResponseWriter.WriteHeader(code)
 }
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
@@ -1,12 +1,20 @@
 package middleware_test
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"ip2country/internal/config"
+	"ip2country/internal/logger"
 	sut "ip2country/internal/middleware"
 )
 
@@ -37,6 +45,245 @@ func TestRateLimitMiddleware(t *testing.T) {
 	}
 }
 
+func TestRateLimitMiddlewareFairness(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:  1,
+		BurstLimit: 2,
+		RateLimitOverrides: []config.RateLimitOverride{
+			{Key: "192.0.2.99", Rate: 1, Burst: 5},
+		},
+	}
+
+	handler := sut.RateLimitMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(remoteAddr string) int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The noisy client exhausts its own burst
+	for i := range 2 {
+		if status := send("192.0.2.1:1000"); status != http.StatusOK {
+			t.Fatalf("request %d of noisy client returned %v, want %v", i, status, http.StatusOK)
+		}
+	}
+	if status := send("192.0.2.1:1001"); status != http.StatusTooManyRequests {
+		t.Errorf("noisy client returned %v after its burst, want %v", status, http.StatusTooManyRequests)
+	}
+
+	// Other clients keep their full budget
+	for i := range 2 {
+		if status := send("192.0.2.2:1000"); status != http.StatusOK {
+			t.Errorf("request %d of quiet client returned %v, want %v", i, status, http.StatusOK)
+		}
+	}
+
+	// Overridden clients get their own burst
+	for i := range 5 {
+		if status := send("192.0.2.99:1000"); status != http.StatusOK {
+			t.Errorf("request %d of overridden client returned %v, want %v", i, status, http.StatusOK)
+		}
+	}
+	if status := send("192.0.2.99:1000"); status != http.StatusTooManyRequests {
+		t.Errorf("overridden client returned %v after its burst, want %v", status, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitMiddlewareKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		request func(i int) *http.Request
+		secret  string // must never be logged
+	}{
+		{
+			name: "API key header shared across addresses",
+			cfg:  &config.Config{RateLimit: 1, BurstLimit: 1, RateLimitKey: config.RateLimitByAPIKey},
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1000", i)
+				req.Header.Set(sut.APIKeyHeader, "key-1")
+				return req
+			},
+			secret: "key-1",
+		},
+		{
+			name: "API key query parameter",
+			cfg:  &config.Config{RateLimit: 1, BurstLimit: 1, RateLimitKey: config.RateLimitByAPIKey},
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/?api_key=key-1", nil)
+				req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1000", i)
+				return req
+			},
+			secret: "key-1",
+		},
+		{
+			name: "Configured header shared across addresses",
+			cfg:  &config.Config{RateLimit: 1, BurstLimit: 1, RateLimitKey: config.RateLimitByHeader, RateLimitHeader: "X-Tenant"},
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1000", i)
+				req.Header.Set("X-Tenant", "tenant-1")
+				return req
+			},
+			secret: "tenant-1",
+		},
+		{
+			name: "Client certificate subject shared across addresses",
+			cfg:  &config.Config{RateLimit: 1, BurstLimit: 1, RateLimitKey: config.RateLimitByClientCert},
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1000", i)
+				req.TLS = verifiedClient("team-a")
+				return req
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			defer slog.SetDefault(previous)
+
+			limiter := sut.NewRateLimiterWithBackend(tt.cfg, sut.NewMemoryBackend())
+			limiter.SetKnownKeys(func(key string) bool { return key == "key-1" })
+			handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, tt.request(1))
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, tt.request(2))
+			if status := rr.Code; status != http.StatusTooManyRequests {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+			}
+			if tt.secret != "" && strings.Contains(logs.String(), tt.secret) {
+				t.Errorf("Expected the key %q to be left out of the logs, got %s", tt.secret, logs.String())
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareClientChosenKeys(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:       1,
+		BurstLimit:      1,
+		RateLimitKey:    config.RateLimitByHeader,
+		RateLimitHeader: "X-Tenant",
+		RateLimitOverrides: []config.RateLimitOverride{
+			{Key: "192.0.2.50", Rate: 1, Burst: 5, Kind: config.RateLimitByIP},
+		},
+	}
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		request  func(i int) *http.Request
+		expected []int
+	}{
+		{
+			name: "Unknown API keys fall back to the client IP",
+			cfg:  &config.Config{RateLimit: 1, BurstLimit: 1, RateLimitKey: config.RateLimitByAPIKey},
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = "192.0.2.1:1000"
+				req.Header.Set(sut.APIKeyHeader, fmt.Sprintf("made-up-%d", i))
+				return req
+			},
+			expected: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "Header values do not inherit the overrides of addresses",
+			cfg:  cfg,
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1000", i)
+				req.Header.Set("X-Tenant", "192.0.2.50")
+				return req
+			},
+			expected: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "Overrides of addresses apply to the fallback",
+			cfg:  cfg,
+			request: func(i int) *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.RemoteAddr = "192.0.2.50:1000"
+				return req
+			},
+			expected: []int{http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := sut.NewRateLimiterWithBackend(tt.cfg, sut.NewMemoryBackend())
+			limiter.SetKnownKeys(func(key string) bool { return key == "key-1" })
+			handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for i, expected := range tt.expected {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, tt.request(i))
+				if rr.Code != expected {
+					t.Errorf("Request %d returned wrong status code: got %v want %v", i, rr.Code, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:  1,
+		BurstLimit: 2,
+	}
+
+	handler := sut.RateLimitMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		expectedStatus     int
+		expectedRemaining  string
+		expectedRetryAfter string
+	}{
+		{expectedStatus: http.StatusOK, expectedRemaining: "1"},
+		{expectedStatus: http.StatusOK, expectedRemaining: "0"},
+		{expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedRetryAfter: "1"},
+	}
+
+	for i, tt := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.expectedStatus {
+			t.Errorf("request %d returned wrong status code: got %v want %v", i, status, tt.expectedStatus)
+		}
+		if limit := rr.Header().Get("RateLimit-Limit"); limit != "2" {
+			t.Errorf("request %d returned wrong RateLimit-Limit: got %v want %v", i, limit, "2")
+		}
+		if remaining := rr.Header().Get("RateLimit-Remaining"); remaining != tt.expectedRemaining {
+			t.Errorf("request %d returned wrong RateLimit-Remaining: got %v want %v", i, remaining, tt.expectedRemaining)
+		}
+		if reset := rr.Header().Get("RateLimit-Reset"); reset == "" || reset == "0" {
+			t.Errorf("request %d returned wrong RateLimit-Reset: got %q", i, reset)
+		}
+		if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tt.expectedRetryAfter {
+			t.Errorf("request %d returned wrong Retry-After: got %q want %q", i, retryAfter, tt.expectedRetryAfter)
+		}
+	}
+}
+
 func TestErrorHandler(t *testing.T) {
 	handler := sut.ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		panic("test panic")
@@ -87,3 +334,248 @@ func TestLoggingMiddleware(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 }
+
+func TestClientIPMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"},
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expectedIP string
+	}{
+		{
+			name:       "Direct connection",
+			remoteAddr: "203.0.113.7:1234",
+			expectedIP: "203.0.113.7",
+		},
+		{
+			name:       "Untrusted peer cannot spoof headers",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-For": "8.8.8.8"},
+			expectedIP: "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For from trusted proxy",
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"X-Forwarded-For": "8.8.8.8, 10.0.0.5"},
+			expectedIP: "8.8.8.8",
+		},
+		{
+			name:       "Spoofed left-most X-Forwarded-For is ignored",
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 8.8.8.8"},
+			expectedIP: "8.8.8.8",
+		},
+		{
+			name:       "Forwarded header",
+			remoteAddr: "192.168.1.1:1234",
+			headers:    map[string]string{"Forwarded": `for="[2001:db8::17]:4711";proto=https, for=10.0.0.9`},
+			expectedIP: "2001:db8::17",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string]string{"X-Real-IP": "8.8.4.4"},
+			expectedIP: "8.8.4.4",
+		},
+		{
+			name:       "Trusted proxy without headers",
+			remoteAddr: "10.1.2.3:1234",
+			expectedIP: "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := sut.ClientIPMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = sut.ClientIP(r).String()
+			}))
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expectedIP {
+				t.Errorf("ClientIP returned wrong address: got %v want %v", got, tt.expectedIP)
+			}
+		})
+	}
+}
+
+// verifiedClient is the TLS state of a connection whose client certificate has the given common name
+func verifiedClient(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestClientSubject(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	if subject := sut.ClientSubject(req); subject != "" {
+		t.Errorf("Expected no subject over plain HTTP, got %s", subject)
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	if subject := sut.ClientSubject(req); subject != "" {
+		t.Errorf("Expected no subject without a verified certificate, got %s", subject)
+	}
+
+	req.TLS = verifiedClient("team-a")
+	if subject := sut.ClientSubject(req); subject != "CN=team-a" {
+		t.Errorf("Expected subject CN=team-a, got %s", subject)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		requestID  string
+		expectSame bool
+	}{
+		{name: "Generated", requestID: ""},
+		{name: "Accepted from client", requestID: "abc-123", expectSame: true},
+		{name: "Replaced when unsafe", requestID: "abc 123\n"},
+		{name: "Replaced when too long", requestID: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := sut.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = sut.RequestID(r)
+			}))
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.requestID != "" {
+				req.Header.Set(sut.RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			echoed := rr.Header().Get(sut.RequestIDHeader)
+			if echoed == "" || echoed != seen {
+				t.Errorf("Expected the request ID %q of the context to be echoed, got %q", seen, echoed)
+			}
+			if tt.expectSame != (echoed == tt.requestID) {
+				t.Errorf("Unexpected request ID %q for client ID %q", echoed, tt.requestID)
+			}
+		})
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logger.NewContextHandler(slog.NewJSONHandler(&buf, nil))))
+	defer slog.SetDefault(previous)
+
+	handler := sut.RequestIDMiddleware(sut.AccessLogMiddleware(
+		[]string{"method", "path", "status", "bytes", "client_ip", "unknown"},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("hello"))
+		}),
+	))
+	req, _ := http.NewRequest("GET", "/v1/find-country?ip=1.2.3.4", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(sut.RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log entry, got %s", buf.String())
+	}
+	expected := map[string]any{
+		"msg":        "access",
+		"method":     "GET",
+		"path":       "/v1/find-country",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(5),
+		"client_ip":  "192.0.2.1",
+		"request_id": "req-1",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["unknown"]; ok {
+		t.Error("Expected unknown fields to be skipped")
+	}
+	if _, ok := entry["query"]; ok {
+		t.Error("Expected fields that were not selected to be skipped")
+	}
+}
+
+func TestAccessLogMiddlewareRedactsAPIKeys(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	handler := sut.AccessLogMiddleware([]string{"query"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req, _ := http.NewRequest("GET", "/v1/find-country?ip=1.2.3.4&api_key=s3cr3t", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log entry, got %s", buf.String())
+	}
+	if expected := "ip=1.2.3.4&api_key=REDACTED"; entry["query"] != expected {
+		t.Errorf("Expected the query %s, got %v", expected, entry["query"])
+	}
+}
+
+func TestRateLimiterSetLimits(t *testing.T) {
+	limiter := sut.NewRateLimiter(&config.Config{RateLimit: 1, BurstLimit: 1})
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(remoteAddr string) int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	serve("203.0.113.1:1234")
+	if status := serve("203.0.113.1:1234"); status != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+	}
+
+	limiter.SetLimits(&config.Config{RateLimit: 1, BurstLimit: 3})
+	for i := range 3 {
+		if status := serve("203.0.113.2:1234"); status != http.StatusOK {
+			t.Fatalf("Request %d within the reloaded burst returned wrong status code: got %v want %v", i, status, http.StatusOK)
+		}
+	}
+	if status := serve("203.0.113.1:1234"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the exhausted bucket to be kept, got status %v", status)
+	}
+}
+
+func TestTrustedProxiesSet(t *testing.T) {
+	proxies := sut.NewTrustedProxies(nil)
+	var got string
+	handler := proxies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = sut.ClientIP(r).String()
+	}))
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-For", "8.8.8.8")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "10.1.2.3" {
+		t.Errorf("ClientIP returned wrong address: got %v want %v", got, "10.1.2.3")
+	}
+
+	proxies.Set([]string{"10.0.0.0/8"})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "8.8.8.8" {
+		t.Errorf("ClientIP returned wrong address after reload: got %v want %v", got, "8.8.8.8")
+	}
+}
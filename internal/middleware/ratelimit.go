@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ip2country/internal/config"
+	"ip2country/internal/metrics"
+)
+
+const (
+	// APIKeyHeader and APIKeyParam carry the caller's API key
+	APIKeyHeader = "X-API-Key"
+	APIKeyParam  = "api_key"
+
+	// bucketIdleTimeout is how long a client may stay silent before its bucket is dropped
+	bucketIdleTimeout = 10 * time.Minute
+	sweepInterval     = time.Minute
+)
+
+// Limit is the token bucket configuration of a client: refill rate in tokens per second and bucket size
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Decision is the outcome of taking a token, along with the bucket state reported to the client
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token is available, when not allowed
+}
+
+// LimiterBackend stores the token buckets of RateLimiter and takes tokens from them atomically
+type LimiterBackend interface {
+	Take(ctx context.Context, key string, lim Limit, now time.Time) (Decision, error)
+}
+
+// RateLimiter keeps a token bucket per client key, so one noisy caller cannot exhaust the budget of everyone else.
+type RateLimiter struct {
+	keyFunc   func(r *http.Request) (string, string)
+	limits    atomic.Pointer[limits]
+	backend   LimiterBackend
+	now       func() time.Time
+	knownKeys atomic.Pointer[func(key string) bool]
+}
+
+// limits are the default and per-client limits of a RateLimiter, replaced as a whole by SetLimits.
+// Overrides are keyed by the kind and the value of the client key, e.g. "ip:10.0.0.7".
+type limits struct {
+	limit     Limit
+	overrides map[string]Limit
+}
+
+// NewRateLimiter creates a limiter using the backend selected by RATE_LIMIT_BACKEND
+func NewRateLimiter(cfg *config.Config) *RateLimiter {
+	var backend LimiterBackend
+	switch cfg.RateLimitBackend {
+	case config.RateLimitBackendRedis:
+		backend = NewRedisBackend(redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		}))
+	default:
+		backend = NewMemoryBackend()
+	}
+	return NewRateLimiterWithBackend(cfg, backend)
+}
+
+func NewRateLimiterWithBackend(cfg *config.Config, backend LimiterBackend) *RateLimiter {
+	l := &RateLimiter{
+		backend: backend,
+		now:     time.Now,
+	}
+	l.keyFunc = rateLimitKeyFunc(cfg, l.isKnownKey)
+	l.SetLimits(cfg)
+	return l
+}
+
+// SetKnownKeys sets the API keys given their own bucket with RATE_LIMIT_KEY api_key. The limiter runs before
+// authentication, so other keys, chosen freely by clients, fall back to the client IP. Without known keys, every
+// client is limited by IP.
+func (l *RateLimiter) SetKnownKeys(known func(key string) bool) {
+	l.knownKeys.Store(&known)
+}
+
+func (l *RateLimiter) isKnownKey(key string) bool {
+	known := l.knownKeys.Load()
+	return known != nil && (*known)(key)
+}
+
+// SetLimits replaces the limits with RATE_LIMIT, BURST_LIMIT and the overrides of cfg. Buckets are kept, so
+// clients are not granted a full burst again, and the new limits apply from their next request.
+// Overrides without a kind apply to the client keys of RATE_LIMIT_KEY.
+func (l *RateLimiter) SetLimits(cfg *config.Config) {
+	overrides := make(map[string]Limit, len(cfg.RateLimitOverrides))
+	for _, override := range cfg.RateLimitOverrides {
+		kind := cmp.Or(override.Kind, cfg.RateLimitKey, config.RateLimitByIP)
+		overrides[kind+":"+override.Key] = Limit{Rate: float64(override.Rate), Burst: override.Burst}
+	}
+	l.limits.Store(&limits{
+		limit:     Limit{Rate: float64(cfg.RateLimit), Burst: cfg.BurstLimit},
+		overrides: overrides,
+	})
+}
+
+// RateLimitMiddleware limits next with a dedicated in-memory RateLimiter. Shared backends hold connections that must
+// be closed, so create the limiter once with NewRateLimiter and Close it on shutdown to use them.
+func RateLimitMiddleware(cfg *config.Config, next http.Handler) http.Handler {
+	return NewRateLimiterWithBackend(cfg, NewMemoryBackend()).Middleware(next)
+}
+
+// Close releases the connections of the backend, if it holds any
+func (l *RateLimiter) Close() error {
+	if closer, ok := l.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind, value := l.keyFunc(r)
+		key := kind + ":" + value
+		d, err := l.backend.Take(r.Context(), key, l.limitFor(key), l.now())
+		if err != nil {
+			// Failing open keeps the service available when a shared backend is unreachable
+			slog.ErrorContext(r.Context(), fmt.Sprintf("Rate Limiting backend error, allowing request: %v", err))
+			next.ServeHTTP(w, r)
+			return
+		}
+		setRateLimitHeaders(w.Header(), d)
+		if d.Allowed {
+			slog.InfoContext(r.Context(), fmt.Sprintf("Rate Limiting tokens remaining for %s: %d", logKey(kind, value), d.Remaining))
+			next.ServeHTTP(w, r)
+		} else {
+			slog.WarnContext(r.Context(), fmt.Sprintf("Rate Limiting: Too Many Requests from %s", logKey(kind, value)))
+			metrics.RateLimitRejected(kind)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+			WriteError(w, http.StatusTooManyRequests, "Too Many Requests")
+		}
+	})
+}
+
+// logKey describes a client key for the logs. API keys and header values may be secrets, so only a short hash of
+// them is logged, enough to tell clients apart.
+func logKey(kind, value string) string {
+	switch kind {
+	case config.RateLimitByAPIKey, config.RateLimitByHeader:
+		sum := sha256.Sum256([]byte(value))
+		return kind + " #" + hex.EncodeToString(sum[:4])
+	}
+	return kind + " " + value
+}
+
+// limitFor returns the limit of a client key, made of its kind and value
+func (l *RateLimiter) limitFor(key string) Limit {
+	current := l.limits.Load()
+	if override, ok := current.overrides[key]; ok {
+		return override
+	}
+	return current.limit
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// MemoryBackend keeps buckets in process memory. Each replica of the service enforces its own limits.
+type MemoryBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take takes a token from the bucket of key, if there is one
+func (m *MemoryBackend) Take(_ context.Context, key string, lim Limit, now time.Time) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(lim.Burst), lastSeen: now}
+		m.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.lastSeen).Seconds() * lim.Rate
+	if b.tokens > float64(lim.Burst) {
+		b.tokens = float64(lim.Burst)
+	}
+	b.lastSeen = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newDecision(allowed, b.tokens, lim), nil
+}
+
+// sweep drops buckets of clients that have been idle for a while. Must be called with the lock held.
+func (m *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.Sub(b.lastSeen) > bucketIdleTimeout {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// newDecision reports the state of a bucket left with the given tokens after taking one, if allowed
+func newDecision(allowed bool, tokens float64, lim Limit) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     lim.Burst,
+		Remaining: int(tokens),
+		Reset:     refillTime(float64(lim.Burst)-tokens, lim.Rate),
+	}
+	if !allowed {
+		d.RetryAfter = refillTime(1-tokens, lim.Rate)
+	}
+	return d
+}
+
+// refillTime is how long it takes to gain the given number of tokens
+func refillTime(tokens, rate float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+// setRateLimitHeaders writes the RateLimit-* fields of the IETF httpapi rate limit headers draft
+func setRateLimitHeaders(h http.Header, d Decision) {
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitKeyFunc returns the function identifying the client of a request as a kind and a value.
+// Requests without a known API key, a client certificate or the configured header fall back to the client IP.
+func rateLimitKeyFunc(cfg *config.Config, knownKey func(key string) bool) func(r *http.Request) (string, string) {
+	byIP := func(r *http.Request) (string, string) {
+		if ip := ClientIP(r); ip != nil {
+			return config.RateLimitByIP, ip.String()
+		}
+		return config.RateLimitByIP, r.RemoteAddr
+	}
+
+	switch cfg.RateLimitKey {
+	case config.RateLimitByAPIKey:
+		return func(r *http.Request) (string, string) {
+			if key := APIKey(r); key != "" && knownKey(key) {
+				return config.RateLimitByAPIKey, key
+			}
+			return byIP(r)
+		}
+	case config.RateLimitByClientCert:
+		return func(r *http.Request) (string, string) {
+			if subject := ClientSubject(r); subject != "" {
+				return config.RateLimitByClientCert, subject
+			}
+			return byIP(r)
+		}
+	case config.RateLimitByHeader:
+		return func(r *http.Request) (string, string) {
+			if value := r.Header.Get(cfg.RateLimitHeader); value != "" {
+				return config.RateLimitByHeader, value
+			}
+			return byIP(r)
+		}
+	default:
+		return byIP
+	}
+}
+
+// APIKey returns the API key sent in the X-API-Key header or the api_key query parameter
+func APIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get(APIKeyParam)
+}
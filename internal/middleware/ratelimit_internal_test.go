@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendEvictsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	m := NewMemoryBackend()
+	lim := Limit{Rate: 1, Burst: 1}
+
+	_, _ = m.Take(context.Background(), "ip:192.0.2.1", lim, now)
+	now = now.Add(bucketIdleTimeout / 2)
+	_, _ = m.Take(context.Background(), "ip:192.0.2.2", lim, now)
+	if len(m.buckets) != 2 {
+		t.Fatalf("Expected 2 buckets, got %d", len(m.buckets))
+	}
+
+	now = now.Add(bucketIdleTimeout/2 + time.Second)
+	_, _ = m.Take(context.Background(), "ip:192.0.2.2", lim, now)
+	if _, ok := m.buckets["ip:192.0.2.1"]; ok {
+		t.Error("Expected the idle bucket to be evicted")
+	}
+	if _, ok := m.buckets["ip:192.0.2.2"]; !ok {
+		t.Error("Expected the active bucket to be kept")
+	}
+}
+
+func TestMemoryBackendRefillsFractionalTokens(t *testing.T) {
+	now := time.Now()
+	m := NewMemoryBackend()
+	lim := Limit{Rate: 1, Burst: 1}
+
+	if d, _ := m.Take(context.Background(), "ip:192.0.2.1", lim, now); !d.Allowed {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	// Two half-second gaps add up to a whole token
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := m.Take(context.Background(), "ip:192.0.2.1", lim, now); d.Allowed {
+		t.Fatal("Expected the second request to be limited")
+	} else if d.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected to retry after half a second, got %v", d.RetryAfter)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := m.Take(context.Background(), "ip:192.0.2.1", lim, now); !d.Allowed {
+		t.Error("Expected the third request to be allowed after a second")
+	}
+}
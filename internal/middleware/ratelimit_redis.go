@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "ip2country:ratelimit:"
+
+// takeScript refills and takes from a bucket in a single atomic step, so replicas sharing the server never race.
+// The bucket is a hash of its tokens and the time it was last refilled in milliseconds, and expires once idle.
+// Time is read from the server rather than the replicas, whose clocks may be skewed. Scripts calling TIME must
+// replicate their effects rather than themselves, the default since Redis 5 which older servers are asked for.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisBackend keeps buckets in a Redis compatible server, so all replicas of the service share the same limits.
+// Buckets refill by the clock of the server, the time passed to Take is ignored.
+type RedisBackend struct {
+	client redis.Scripter
+}
+
+func NewRedisBackend(client redis.Scripter) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+// Close closes the client of the backend, when it can be closed
+func (b *RedisBackend) Close() error {
+	if closer, ok := b.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (b *RedisBackend) Take(ctx context.Context, key string, lim Limit, _ time.Time) (Decision, error) {
+	result, err := takeScript.Run(ctx, b.client, []string{redisKeyPrefix + key},
+		lim.Rate, lim.Burst, bucketIdleTimeout.Milliseconds()).Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to take a token from redis: %w", err)
+	}
+	if len(result) != 2 {
+		return Decision{}, fmt.Errorf("unexpected redis rate limit reply %v", result)
+	}
+
+	allowed, ok := result[0].(int64)
+	if !ok {
+		return Decision{}, fmt.Errorf("unexpected redis rate limit reply %v", result)
+	}
+	tokensStr, ok := result[1].(string)
+	if !ok {
+		return Decision{}, fmt.Errorf("unexpected redis rate limit reply %v", result)
+	}
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Decision{}, fmt.Errorf("unexpected redis rate limit tokens %s: %w", tokensStr, err)
+	}
+	return newDecision(allowed == 1, tokens, lim), nil
+}
@@ -0,0 +1,147 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"ip2country/internal/config"
+	sut "ip2country/internal/middleware"
+)
+
+func newRedisBackend(t *testing.T) (*sut.RedisBackend, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return sut.NewRedisBackend(client), server
+}
+
+func TestRedisBackendSharedAcrossReplicas(t *testing.T) {
+	backend, _ := newRedisBackend(t)
+	cfg := &config.Config{
+		RateLimit:  1,
+		BurstLimit: 2,
+	}
+
+	// Two replicas of the service talking to the same server
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	replicas := []http.Handler{
+		sut.NewRateLimiterWithBackend(cfg, backend).Middleware(ok),
+		sut.NewRateLimiterWithBackend(cfg, backend).Middleware(ok),
+	}
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for i, status := range expected {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:1000"
+		rr := httptest.NewRecorder()
+		replicas[i%2].ServeHTTP(rr, req)
+
+		if rr.Code != status {
+			t.Errorf("request %d returned wrong status code: got %v want %v", i, rr.Code, status)
+		}
+	}
+
+	// Other clients are not affected
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.2:1000"
+	rr := httptest.NewRecorder()
+	replicas[0].ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("other client returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if remaining := rr.Header().Get("RateLimit-Remaining"); remaining != "1" {
+		t.Errorf("other client returned wrong RateLimit-Remaining: got %v want %v", remaining, "1")
+	}
+}
+
+func TestRedisBackendIgnoresReplicaClocks(t *testing.T) {
+	backend, server := newRedisBackend(t)
+	server.SetTime(time.Now())
+	lim := sut.Limit{Rate: 1, Burst: 1}
+
+	// A replica whose clock runs an hour ahead does not refill the bucket taken by another one
+	tests := []struct {
+		name    string
+		now     time.Time
+		allowed bool
+	}{
+		{"first request", time.Now(), true},
+		{"replica ahead by an hour", time.Now().Add(time.Hour), false},
+		{"replica behind by an hour", time.Now().Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		d, err := backend.Take(context.Background(), "ip:192.0.2.1", lim, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed != tt.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", tt.name, tt.allowed, d.Allowed)
+		}
+	}
+
+	// The bucket refills as the clock of the server moves
+	server.SetTime(time.Now().Add(time.Second))
+	if d, err := backend.Take(context.Background(), "ip:192.0.2.1", lim, time.Time{}); err != nil || !d.Allowed {
+		t.Errorf("Expected a token once the server clock moved a second, got %+v and %v", d, err)
+	}
+}
+
+func TestRedisBackendExpiresIdleBuckets(t *testing.T) {
+	backend, server := newRedisBackend(t)
+	handler := sut.NewRateLimiterWithBackend(&config.Config{RateLimit: 1, BurstLimit: 1}, backend).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	keys := server.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("Expected one bucket, got %v", keys)
+	}
+	if ttl := server.TTL(keys[0]); ttl <= 0 {
+		t.Errorf("Expected the bucket to expire, got TTL %v", ttl)
+	}
+}
+
+func TestRedisBackendFailsOpen(t *testing.T) {
+	backend, server := newRedisBackend(t)
+	server.Close()
+
+	handler := sut.NewRateLimiterWithBackend(&config.Config{RateLimit: 1, BurstLimit: 1}, backend).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimiterCloseClosesRedisClient(t *testing.T) {
+	server := miniredis.RunT(t)
+	limiter := sut.NewRateLimiter(&config.Config{
+		RateLimit:        1,
+		BurstLimit:       1,
+		RateLimitBackend: config.RateLimitBackendRedis,
+		RedisAddr:        server.Addr(),
+	})
+	if err := limiter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Close(); err == nil {
+		t.Error("Expected the Redis client to be closed already")
+	}
+}
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"ip2country/internal/config"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// boundListener is an open listener along with the configuration it was opened from
+type boundListener struct {
+	net.Listener
+	cfg config.ListenerConfig
+}
+
+// ListenerConfigs returns the configured listeners, or a single public TCP listener on PORT when there are none
+func ListenerConfigs(cfg *config.Config) []config.ListenerConfig {
+	if len(cfg.Listeners) > 0 {
+		return cfg.Listeners
+	}
+	return []config.ListenerConfig{{Network: config.ListenerTCP, Address: fmt.Sprintf(":%d", cfg.Port)}}
+}
+
+// listen opens every listener, closing those already open when one fails
+func listen(configs []config.ListenerConfig) ([]boundListener, error) {
+	var activated *systemdSockets
+	listeners := make([]boundListener, 0, len(configs))
+	for _, lc := range configs {
+		lis, err := openListener(lc, &activated)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s %s: %w", lc.Network, lc.Address, err)
+		}
+		listeners = append(listeners, boundListener{Listener: lis, cfg: lc})
+	}
+	return listeners, nil
+}
+
+// openListener opens the listener of lc. Sockets passed by systemd are collected into activated on first use.
+func openListener(lc config.ListenerConfig, activated **systemdSockets) (net.Listener, error) {
+	switch lc.Profile {
+	case "", config.ProfilePublic, config.ProfileInternal:
+	default:
+		return nil, fmt.Errorf("unknown listener profile: %s", lc.Profile)
+	}
+
+	switch lc.Network {
+	case config.ListenerTCP, "":
+		return net.Listen("tcp", lc.Address)
+	case config.ListenerUnix:
+		return listenUnix(lc.Address, lc.Mode)
+	case config.ListenerSystemd:
+		if *activated == nil {
+			sockets, err := newSystemdSockets(os.Getpid(), os.Getenv, listenFDsStart)
+			if err != nil {
+				return nil, err
+			}
+			*activated = sockets
+		}
+		return (*activated).take(lc.Address)
+	default:
+		return nil, fmt.Errorf("unknown listener network: %s", lc.Network)
+	}
+}
+
+// listenUnix listens on a Unix socket at path, replacing a stale socket left by a previous run
+func listenUnix(path, mode string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			_ = lis.Close()
+			return nil, fmt.Errorf("invalid socket mode %s: %w", mode, err)
+		}
+		if err := os.Chmod(path, fs.FileMode(perm)); err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+// systemdSockets are the listening sockets passed by systemd socket activation, see sd_listen_fds(3)
+type systemdSockets struct {
+	listeners []net.Listener
+	names     []string
+	taken     []bool
+}
+
+func newSystemdSockets(pid int, getenv func(string) string, firstFD int) (*systemdSockets, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return nil, errors.New("no sockets were passed by systemd socket activation")
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %q", getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	sockets := &systemdSockets{
+		listeners: make([]net.Listener, count),
+		names:     make([]string, count),
+		taken:     make([]bool, count),
+	}
+	for i := range count {
+		if i < len(names) {
+			sockets.names[i] = names[i]
+		}
+		f := os.NewFile(uintptr(firstFD+i), sockets.names[i])
+		lis, err := net.FileListener(f)
+		// FileListener duplicates the descriptor, the original is not needed anymore
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %d passed by systemd is not a listener: %w", firstFD+i, err)
+		}
+		sockets.listeners[i] = lis
+	}
+	return sockets, nil
+}
+
+// take returns the socket with the given name, or the first one not taken yet when name is empty
+func (s *systemdSockets) take(name string) (net.Listener, error) {
+	for i, lis := range s.listeners {
+		if s.taken[i] || (name != "" && s.names[i] != name) {
+			continue
+		}
+		s.taken[i] = true
+		return lis, nil
+	}
+	if name == "" {
+		return nil, errors.New("every socket passed by systemd is already in use")
+	}
+	return nil, fmt.Errorf("no socket named %s was passed by systemd", name)
+}
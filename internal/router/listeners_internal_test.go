@@ -0,0 +1,54 @@
+package router
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestSystemdSockets(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	// A raw duplicate of the listener's descriptor stands in for the socket systemd would pass, and is adopted
+	// and closed by newSystemdSockets
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "http",
+	}
+	if _, err := newSystemdSockets(43, func(key string) string { return env[key] }, fd); err == nil {
+		t.Error("Expected sockets passed to another process to be ignored")
+	}
+
+	sockets, err := newSystemdSockets(42, func(key string) string { return env[key] }, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sockets.take("metrics"); err == nil {
+		t.Error("Expected an error for an unknown socket name")
+	}
+	lis, err := sockets.take("http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if lis.Addr().String() != tcp.Addr().String() {
+		t.Errorf("Expected listener on %s, got %s", tcp.Addr(), lis.Addr())
+	}
+	if _, err := sockets.take(""); err == nil {
+		t.Error("Expected an error once every socket is taken")
+	}
+}
@@ -2,32 +2,202 @@
 package router
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
 
+	"ip2country/internal/auth"
 	"ip2country/internal/config"
 	"ip2country/internal/ip2country/handler"
+	"ip2country/internal/metrics"
 	"ip2country/internal/middleware"
+	"ip2country/internal/tlsconfig"
+	"ip2country/internal/tracing"
 )
 
+var authenticator *auth.Authenticator
+
+// shared is the state of the middleware shared by every listener of a server, which Reload updates
+type shared struct {
+	limiter *middleware.RateLimiter
+	proxies *middleware.TrustedProxies
+}
+
+func newShared(cfg *config.Config) *shared {
+	limiter := middleware.NewRateLimiter(cfg)
+	// Only known API keys get their own bucket, other keys are chosen freely by clients
+	if authenticator != nil {
+		limiter.SetKnownKeys(authenticator.Known)
+	}
+	return &shared{
+		limiter: limiter,
+		proxies: middleware.NewTrustedProxies(cfg.TrustedProxies),
+	}
+}
+
+// running is the state of the server started last by StartServer
+var running atomic.Pointer[shared]
+
+// SetAuthenticator requires an API key on every route of routers created afterwards
+func SetAuthenticator(a *auth.Authenticator) {
+	authenticator = a
+}
+
+// Reload applies the rate limits and trusted proxies of cfg to the running server
+func Reload(cfg *config.Config) {
+	if state := running.Load(); state != nil {
+		state.limiter.SetLimits(cfg)
+		state.proxies.Set(cfg.TrustedProxies)
+	}
+}
+
+// NewRouter creates the router of a public listener
 func NewRouter(cfg *config.Config) *mux.Router {
+	return newRouter(cfg, config.ProfilePublic, newShared(cfg))
+}
+
+// newRouter creates the router of a listener with the given middleware profile. Listeners of a server share state.
+func newRouter(cfg *config.Config, profile string, state *shared) *mux.Router {
+	if unknown := middleware.UnknownAccessLogFields(cfg.AccessLogFields); len(unknown) > 0 {
+		slog.Warn(fmt.Sprintf("Unknown access log fields are skipped: %v", unknown))
+	}
 	r := mux.NewRouter()
-	r.Use(middleware.LoggingMiddleware)
-	r.Use(middleware.ErrorHandler)
-	r.Use(func(next http.Handler) http.Handler {
-		return middleware.RateLimitMiddleware(cfg, next)
-	})
-	r.HandleFunc("/v1/find-country", handler.FindCountryHandler).Methods("GET")
+	common := []mux.MiddlewareFunc{
+		// The server span comes first so that the spans of middleware and stores are part of the request's trace
+		tracing.Middleware,
+		middleware.RequestIDMiddleware,
+		// The client address is resolved first so that access logs report it
+		state.proxies.Middleware,
+		func(next http.Handler) http.Handler {
+			return middleware.AccessLogMiddleware(cfg.AccessLogFields, next)
+		},
+		middleware.ErrorHandler,
+		metrics.Middleware,
+	}
+	r.Use(common...)
+	// gorilla/mux only runs the middleware of matched routes, requests matching none are wrapped in it explicitly
+	// so that they are traced, logged and counted too
+	unmatched := func(h http.Handler) http.Handler {
+		for i := len(common) - 1; i >= 0; i-- {
+			h = common[i](h)
+		}
+		return h
+	}
+	r.NotFoundHandler = unmatched(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = unmatched(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", handler.HealthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", handler.ReadyzHandler).Methods("GET")
+	// Administration is only exposed to the trusted callers of internal listeners
+	if profile == config.ProfileInternal {
+		r.HandleFunc("/admin/log-level", handler.LogLevelHandler).Methods("GET", "PUT", "POST")
+	}
+
+	// Only the lookup API is rate limited and authenticated, probes and scrapers of the operational endpoints are not.
+	// Internal listeners are not rate limited, but still authenticated.
+	api := r.PathPrefix("/v1").Subrouter()
+	if profile != config.ProfileInternal {
+		api.Use(tracing.Wrap("rate_limit", state.limiter.Middleware))
+	}
+	if authenticator != nil {
+		api.Use(tracing.Wrap("auth", authenticator.Middleware))
+	}
+	api.HandleFunc("/find-country", handler.FindCountryHandler).Methods("GET")
+	api.HandleFunc("/me", handler.WhoAmIHandler).Methods("GET")
 	return r
 }
 
-func StartServer(cfg *config.Config) {
-	r := NewRouter(cfg)
-	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: r,
+// NewServer creates an HTTP server of the service with the timeouts and header limit from cfg
+func NewServer(cfg *config.Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// StartServer serves HTTP on every configured listener until ctx is done, then gives in-flight requests
+// SHUTDOWN_TIMEOUT to complete. It returns an error when a listener cannot start or does not drain in time.
+// TLS, when enabled, applies to TCP and systemd listeners, Unix sockets are served in plain HTTP.
+func StartServer(ctx context.Context, cfg *config.Config) error {
+	var tlsConfig *tls.Config
+	if tlsconfig.Enabled(cfg.TLS) {
+		var reloader *tlsconfig.CertReloader
+		var err error
+		tlsConfig, reloader, err = tlsconfig.NewServerConfig(cfg.TLS)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = reloader.Close() }()
+	}
+
+	listeners, err := listen(ListenerConfigs(cfg))
+	if err != nil {
+		return err
+	}
+
+	state := newShared(cfg)
+	defer func() { _ = state.limiter.Close() }()
+	running.Store(state)
+	servers, ctx := errgroup.WithContext(ctx)
+	for _, lis := range listeners {
+		profile := lis.cfg.Profile
+		if profile == "" {
+			profile = config.ProfilePublic
+		}
+		httpServer := NewServer(cfg, newRouter(cfg, profile, state))
+		if lis.cfg.Network != config.ListenerUnix {
+			httpServer.TLSConfig = tlsConfig
+		}
+		slog.Info(fmt.Sprintf("Serving HTTP on %s %s with the %s profile", lis.Addr().Network(), lis.Addr(), profile))
+		servers.Go(func() error {
+			return Serve(ctx, httpServer, lis, cfg.ShutdownTimeout)
+		})
+	}
+	return servers.Wait()
+}
+
+// Serve runs httpServer on lis until ctx is done and shuts it down gracefully within timeout.
+// HTTPS is served when httpServer has a TLS configuration.
+func Serve(ctx context.Context, httpServer *http.Server, lis net.Listener, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			errs <- httpServer.ServeTLS(lis, "", "")
+		} else {
+			errs <- httpServer.Serve(lis)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("HTTP server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info(fmt.Sprintf("Shutting down HTTP server, waiting up to %s for in-flight requests", timeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		_ = httpServer.Close()
+		return fmt.Errorf("HTTP server shutdown: %w", err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
-	_ = httpServer.ListenAndServe()
+	return nil
 }
@@ -0,0 +1,264 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ip2country/internal/config"
+	"ip2country/internal/metrics"
+	sut "ip2country/internal/router"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- sut.Serve(ctx, httpServer, lis, time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + lis.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Errorf("Expected in-flight request to complete, got %q, %v", res.body, res.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected graceful shutdown, got %v", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- sut.Serve(ctx, httpServer, lis, 50*time.Millisecond)
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + lis.Addr().String()); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+	if err := <-served; err == nil {
+		t.Error("Expected an error when requests do not drain in time")
+	}
+}
+
+func TestStartServerReportsListenErrors(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	cfg := &config.Config{Port: lis.Addr().(*net.TCPAddr).Port, RateLimit: 1, BurstLimit: 1}
+	if err := sut.StartServer(context.Background(), cfg); err == nil {
+		t.Error("Expected an error when the port is in use")
+	}
+}
+
+// unixClient sends every request to the Unix socket at path
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestStartServerListenerProfiles(t *testing.T) {
+	dir := t.TempDir()
+	publicSocket, internalSocket := filepath.Join(dir, "public.sock"), filepath.Join(dir, "internal.sock")
+	cfg := &config.Config{
+		RateLimit:       1,
+		BurstLimit:      1,
+		ShutdownTimeout: time.Second,
+		Listeners: []config.ListenerConfig{
+			{Network: config.ListenerUnix, Address: publicSocket},
+			{Network: config.ListenerUnix, Address: internalSocket, Mode: "0600", Profile: config.ProfileInternal},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- sut.StartServer(ctx, cfg)
+	}()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("Expected graceful shutdown, got %v", err)
+		}
+	}()
+
+	tests := []struct {
+		name           string
+		socket         string
+		expectedStatus int
+	}{
+		{name: "Public listener is rate limited", socket: publicSocket, expectedStatus: http.StatusTooManyRequests},
+		{name: "Internal listener is not rate limited", socket: internalSocket, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := unixClient(tt.socket)
+			var status int
+			deadline := time.Now().Add(5 * time.Second)
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get("http://ip2country/v1/find-country")
+				for err != nil && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+					resp, err = client.Get("http://ip2country/v1/find-country")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = resp.Body.Close()
+				status = resp.StatusCode
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("Second request returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+		})
+	}
+
+	for _, admin := range []struct {
+		socket         string
+		expectedStatus int
+	}{
+		{socket: publicSocket, expectedStatus: http.StatusNotFound},
+		{socket: internalSocket, expectedStatus: http.StatusOK},
+	} {
+		resp, err := unixClient(admin.socket).Get("http://ip2country/admin/log-level")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != admin.expectedStatus {
+			t.Errorf("Log level endpoint on %s returned wrong status code: got %v want %v",
+				filepath.Base(admin.socket), resp.StatusCode, admin.expectedStatus)
+		}
+	}
+
+	info, err := os.Stat(internalSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected socket mode 0600, got %o", perm)
+	}
+}
+
+func TestStartServerInvalidListeners(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener config.ListenerConfig
+	}{
+		{name: "Unknown network", listener: config.ListenerConfig{Network: "sctp", Address: ":0"}},
+		{name: "Unknown profile", listener: config.ListenerConfig{Address: "127.0.0.1:0", Profile: "private"}},
+		{name: "Invalid socket mode", listener: config.ListenerConfig{Network: config.ListenerUnix, Address: filepath.Join(t.TempDir(), "s.sock"), Mode: "rw"}},
+		{name: "Systemd without socket activation", listener: config.ListenerConfig{Network: config.ListenerSystemd}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{RateLimit: 1, BurstLimit: 1, Listeners: []config.ListenerConfig{tt.listener}}
+			if err := sut.StartServer(context.Background(), cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestUnmatchedRequestsAreCountedAndLogged(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	r := sut.NewRouter(&config.Config{RateLimit: 1, BurstLimit: 1})
+	tests := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"GET", "/no-such-path", http.StatusNotFound},
+		{"DELETE", "/healthz", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		r.ServeHTTP(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tt.method, tt.path, rr.Code, tt.expected)
+		}
+		if entry := fmt.Sprintf("method=%s path=%s status=%d", tt.method, tt.path, tt.expected); !strings.Contains(logs.String(), entry) {
+			t.Errorf("Expected an access log entry with %s, got %s", entry, logs.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	metrics.Handler().ServeHTTP(rr, req)
+	for _, expected := range []string{
+		`ip2country_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`ip2country_http_requests_total{method="DELETE",route="unmatched",status="405"}`,
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("Expected metrics to contain %s", expected)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package tlsconfig Description: This package contains the TLS settings of the ip2country HTTP listener,
+// including reloading of rotated certificates and client certificate verification.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+
+	"ip2country/internal/config"
+)
+
+// Enabled reports whether the configuration asks for TLS
+func Enabled(cfg config.TLSConfig) bool {
+	return cfg.CertFile != ""
+}
+
+// NewServerConfig builds the TLS configuration of the HTTP listener. The certificate is served by the returned
+// CertReloader, which must be closed once the listener is done.
+func NewServerConfig(cfg config.TLSConfig) (*tls.Config, *CertReloader, error) {
+	if cfg.KeyFile == "" {
+		return nil, nil, errors.New("TLS key file is not set")
+	}
+	reloader, err := NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, reloader, nil
+	}
+
+	pool, err := loadCertPool(cfg.ClientCAFile)
+	if err != nil {
+		_ = reloader.Close()
+		return nil, nil, err
+	}
+	tlsConfig.ClientCAs = pool
+	switch cfg.ClientAuth {
+	case config.TLSClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.TLSClientAuthRequire, "":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		_ = reloader.Close()
+		return nil, nil, fmt.Errorf("unknown TLS client auth mode: %s", cfg.ClientAuth)
+	}
+	return tlsConfig, reloader, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file %s: %w", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", path)
+	}
+	return pool, nil
+}
+
+// CertReloader serves a certificate and key pair, reloading them whenever either file changes
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewCertReloader loads the certificate and starts watching its files for changes
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{certFile: certFile, keyFile: keyFile, done: make(chan struct{})}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch certificate: %w", err)
+	}
+	// Watch the directories, certificate managers and secret mounts replace the files rather than writing them in place
+	for _, dir := range uniqueDirs(certFile, keyFile) {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, fmt.Errorf("failed to watch certificate directory %s: %w", dir, err)
+		}
+	}
+	cr.watcher = watcher
+	cr.wg.Add(1)
+	go cr.watch()
+	return cr, nil
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate
+func (cr *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+func (cr *CertReloader) Close() error {
+	close(cr.done)
+	err := cr.watcher.Close()
+	cr.wg.Wait()
+	return err
+}
+
+func (cr *CertReloader) watch() {
+	defer cr.wg.Done()
+	targets := map[string]bool{filepath.Clean(cr.certFile): true, filepath.Clean(cr.keyFile): true}
+	for {
+		select {
+		case <-cr.done:
+			return
+		case event, ok := <-cr.watcher.Events:
+			if !ok {
+				return
+			}
+			// Kubernetes secret mounts swap a "..data" symlink instead of touching the files themselves
+			if !targets[filepath.Clean(event.Name)] && filepath.Base(event.Name) != "..data" {
+				continue
+			}
+			if !event.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename) {
+				continue
+			}
+			// The certificate and key are rarely replaced at once, a mismatched pair is retried on the next event
+			if err := cr.reload(); err != nil {
+				slog.Error(fmt.Sprintf("Error reloading TLS certificate, keeping the previous certificate: %v", err))
+				continue
+			}
+			slog.Info(fmt.Sprintf("Reloaded TLS certificate from %s", cr.certFile))
+		case err, ok := <-cr.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error(fmt.Sprintf("Error watching TLS certificate: %v", err))
+		}
+	}
+}
+
+func (cr *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate %s: %w", cr.certFile, err)
+	}
+	cr.cert.Store(&cert)
+	return nil
+}
+
+func uniqueDirs(paths ...string) []string {
+	dirs := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
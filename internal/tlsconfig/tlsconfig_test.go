@@ -0,0 +1,234 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ip2country/internal/config"
+	"ip2country/internal/middleware"
+	sut "ip2country/internal/tlsconfig"
+)
+
+type certificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for commonName, signed by parent or self-signed when parent is nil
+func issue(t *testing.T, commonName string, parent *certificate) *certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &certificate{cert: cert, key: key}
+}
+
+// write saves the certificate and key in PEM files named after prefix in dir
+func (c *certificate) write(t *testing.T, dir, prefix string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, prefix+".crt"), filepath.Join(dir, prefix+".key")
+	writeAtomic(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+	writeAtomic(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func (c *certificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func writeAtomic(t *testing.T, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "test-ca", nil)
+	certFile, keyFile := issue(t, "server-1", ca).write(t, dir, "server")
+
+	reloader, err := sut.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Close()
+
+	commonName := func() string {
+		cert, _ := reloader.GetCertificate(nil)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.Subject.CommonName
+	}
+	if name := commonName(); name != "server-1" {
+		t.Fatalf("Expected certificate server-1, got %s", name)
+	}
+
+	issue(t, "server-2", ca).write(t, dir, "server")
+	deadline := time.Now().Add(5 * time.Second)
+	for commonName() != "server-2" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the rotated certificate to be loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewServerConfigMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "test-ca", nil)
+	certFile, keyFile := issue(t, "server", ca).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	tests := []struct {
+		name            string
+		clientAuth      string
+		clientCert      *certificate
+		expectedSubject string
+		expectedErr     bool
+	}{
+		{
+			name:            "Verified client certificate",
+			clientAuth:      config.TLSClientAuthRequire,
+			clientCert:      issue(t, "team-a", ca),
+			expectedSubject: "CN=team-a",
+		},
+		{
+			name:        "Missing client certificate",
+			clientAuth:  config.TLSClientAuthRequire,
+			expectedErr: true,
+		},
+		{
+			name:        "Client certificate from another CA",
+			clientAuth:  config.TLSClientAuthOptional,
+			clientCert:  issue(t, "team-b", issue(t, "other-ca", nil)),
+			expectedErr: true,
+		},
+		{
+			name:       "Optional client certificate",
+			clientAuth: config.TLSClientAuthOptional,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, reloader, err := sut.NewServerConfig(config.TLSConfig{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				ClientCAFile: caFile,
+				ClientAuth:   tt.clientAuth,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reloader.Close()
+
+			// httptest servers bring their own certificate, which would take precedence over GetCertificate
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, middleware.ClientSubject(r))
+			}), ErrorLog: log.New(io.Discard, "", 0)}
+			go func() { _ = server.Serve(tls.NewListener(lis, tlsConfig)) }()
+			defer server.Close()
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			clientConfig := &tls.Config{RootCAs: roots}
+			if tt.clientCert != nil {
+				// Always present the certificate, even when it was not issued by a CA the server accepts
+				clientCert := tt.clientCert.tlsCertificate()
+				clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &clientCert, nil
+				}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+			resp, err := client.Get("https://" + lis.Addr().String())
+			if tt.expectedErr {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Fatal("Expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.expectedSubject {
+				t.Errorf("Expected client subject %q, got %q", tt.expectedSubject, body)
+			}
+		})
+	}
+}
+
+func TestNewServerConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := issue(t, "server", nil).write(t, dir, "server")
+
+	tests := []struct {
+		name string
+		cfg  config.TLSConfig
+	}{
+		{name: "Missing key", cfg: config.TLSConfig{CertFile: certFile}},
+		{name: "Missing certificate", cfg: config.TLSConfig{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}},
+		{name: "Missing client CA", cfg: config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "missing.crt")}},
+		{name: "Unknown client auth", cfg: config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, ClientAuth: "sometimes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := sut.NewServerConfig(tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
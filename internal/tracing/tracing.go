@@ -0,0 +1,118 @@
+// Package tracing Description: This package contains the OpenTelemetry tracing of the ip2country service.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"ip2country/internal/config"
+)
+
+const tracerName = "ip2country"
+
+// legacyHTTPURLKey is the attribute of the URL of client requests before url.full, still set by default by otelhttp
+const legacyHTTPURLKey = attribute.Key("http.url")
+
+// Tracer returns the tracer of the service. Spans are dropped until Init installs an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Init installs the exporter selected by the tracing configuration and W3C trace context propagation.
+// The returned function flushes and stops the exporter.
+func Init(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	// Propagation applies even without an exporter, so traces of callers continue through the service
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Tracing.Exporter {
+	case config.TracingExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case config.TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TracingExporterOTLP:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Tracing.Endpoint)}
+		if cfg.Tracing.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Tracing.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(cfg.Logger.ServiceName),
+			semconv.ServiceVersion(cfg.Logger.ServiceVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span per request, continuing the trace of the traceparent header.
+// Spans are named after the route template matched by gorilla/mux, e.g. "GET /v1/find-country".
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				return r.Method + " " + template
+			}
+		}
+		return r.Method
+	}))
+}
+
+// Wrap traces the time spent in a middleware, and everything it calls, as a span with the given name
+func Wrap(name string, middleware mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		wrapped := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := Tracer().Start(r.Context(), "middleware "+name)
+			defer span.End()
+			wrapped.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Transport traces outbound requests made with base and injects the traceparent header into them.
+// The URL of the client spans is redacted, as upstream URLs may carry keys in their query.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(redactingTransport{base})
+}
+
+// redactingTransport replaces the URL set by otelhttp on the span of the request, which only hides its user info,
+// with the URL redacted by config.RedactURL. otelhttp sets http.url, url.full or both depending on
+// OTEL_SEMCONV_STABILITY_OPT_IN, so both are replaced.
+type redactingTransport struct {
+	base http.RoundTripper
+}
+
+func (t redactingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	redacted := config.RedactURL(req.URL.String())
+	trace.SpanFromContext(req.Context()).SetAttributes(legacyHTTPURLKey.String(redacted), semconv.URLFull(redacted))
+	return t.base.RoundTrip(req)
+}
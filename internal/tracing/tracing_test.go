@@ -0,0 +1,157 @@
+package tracing_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"ip2country/internal/config"
+	stores "ip2country/internal/ip2country/store"
+	sut "ip2country/internal/tracing"
+	"ip2country/pkg/store"
+)
+
+type mockStore struct{}
+
+func (m *mockStore) GetInfoByIP(ip net.IP) (*store.SubnetInfo, error) {
+	return &store.SubnetInfo{Country: "Israel"}, nil
+}
+
+// record installs a tracer provider keeping every ended span in memory
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := sut.Init(context.Background(), &config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spansByName(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func TestRequestSpans(t *testing.T) {
+	recorder := record(t)
+
+	r := mux.NewRouter()
+	r.Use(sut.Middleware)
+	r.Use(sut.Wrap("rate_limit", func(next http.Handler) http.Handler { return next }))
+	r.HandleFunc("/v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = stores.LookupContext(r.Context(), &mockStore{}, net.ParseIP("1.2.3.4"))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/items/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := spansByName(recorder)
+	server, ok := spans["GET /v1/items/{id}"]
+	if !ok {
+		t.Fatalf("Expected a server span named after the route template, got %v", spans)
+	}
+	if traceID := server.SpanContext().TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace of the traceparent header to continue, got trace %s", traceID)
+	}
+	if parent := server.Parent().SpanID().String(); parent != "00f067aa0ba902b7" {
+		t.Errorf("Expected the server span to be a child of the caller's span, got parent %s", parent)
+	}
+
+	middlewareSpan, ok := spans["middleware rate_limit"]
+	if !ok {
+		t.Fatal("Expected a span for the middleware")
+	}
+	if middlewareSpan.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("Expected the middleware span to be a child of the server span")
+	}
+
+	lookup, ok := spans["store.lookup"]
+	if !ok {
+		t.Fatal("Expected a span for the store lookup")
+	}
+	if lookup.Parent().SpanID() != middlewareSpan.SpanContext().SpanID() {
+		t.Error("Expected the store span to be a child of the middleware span")
+	}
+}
+
+func TestTransportPropagatesTraceContext(t *testing.T) {
+	recorder := record(t)
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, span := sut.Tracer().Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, "GET", upstream.URL, nil)
+	resp, err := (&http.Client{Transport: sut.Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	if len(traceparent) != 55 || traceparent[3:35] != traceID {
+		t.Errorf("Expected a traceparent header of trace %s, got %q", traceID, traceparent)
+	}
+	if len(recorder.Ended()) != 2 {
+		t.Errorf("Expected a client span along with the parent span, got %d spans", len(recorder.Ended()))
+	}
+}
+
+func TestTransportRedactsURL(t *testing.T) {
+	recorder := record(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	req, _ := http.NewRequest("GET", upstream.URL+"/json/8.8.8.8?key=s3cr3t-upstream-key", nil)
+	resp, err := (&http.Client{Transport: sut.Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected a client span, got %d spans", len(spans))
+	}
+	found := false
+	for _, attr := range spans[0].Attributes() {
+		if strings.Contains(attr.Value.Emit(), "s3cr3t-upstream-key") {
+			t.Errorf("Expected the key to be redacted, got %s=%s", attr.Key, attr.Value.Emit())
+		}
+		if attr.Key == "http.url" || attr.Key == semconv.URLFullKey {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected the redacted URL of the request")
+	}
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	cfg := &config.Config{Tracing: config.TracingConfig{Exporter: "zipkin"}}
+	if _, err := sut.Init(context.Background(), cfg); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: ip2country/v1/ip2country.proto
+
+package ip2countryv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IP2CountryService_Lookup_FullMethodName       = "/ip2country.v1.IP2CountryService/Lookup"
+	IP2CountryService_BatchLookup_FullMethodName  = "/ip2country.v1.IP2CountryService/BatchLookup"
+	IP2CountryService_StreamLookup_FullMethodName = "/ip2country.v1.IP2CountryService/StreamLookup"
+)
+
+// IP2CountryServiceClient is the client API for IP2CountryService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IP2CountryService resolves IP addresses to their country and city.
+type IP2CountryServiceClient interface {
+	// Lookup resolves a single address. Unknown addresses return NOT_FOUND.
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error)
+	// BatchLookup resolves several addresses at once, reporting failures per address.
+	BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error)
+	// StreamLookup resolves several addresses, sending each result as soon as it is available.
+	StreamLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LookupResult], error)
+}
+
+type iP2CountryServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIP2CountryServiceClient(cc grpc.ClientConnInterface) IP2CountryServiceClient {
+	return &iP2CountryServiceClient{cc}
+}
+
+func (c *iP2CountryServiceClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupResponse)
+	err := c.cc.Invoke(ctx, IP2CountryService_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iP2CountryServiceClient) BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchLookupResponse)
+	err := c.cc.Invoke(ctx, IP2CountryService_BatchLookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iP2CountryServiceClient) StreamLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LookupResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IP2CountryService_ServiceDesc.Streams[0], IP2CountryService_StreamLookup_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchLookupRequest, LookupResult]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IP2CountryService_StreamLookupClient = grpc.ServerStreamingClient[LookupResult]
+
+// IP2CountryServiceServer is the server API for IP2CountryService service.
+// All implementations must embed UnimplementedIP2CountryServiceServer
+// for forward compatibility.
+//
+// IP2CountryService resolves IP addresses to their country and city.
+type IP2CountryServiceServer interface {
+	// Lookup resolves a single address. Unknown addresses return NOT_FOUND.
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+	// BatchLookup resolves several addresses at once, reporting failures per address.
+	BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error)
+	// StreamLookup resolves several addresses, sending each result as soon as it is available.
+	StreamLookup(*BatchLookupRequest, grpc.ServerStreamingServer[LookupResult]) error
+	mustEmbedUnimplementedIP2CountryServiceServer()
+}
+
+// UnimplementedIP2CountryServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIP2CountryServiceServer struct{}
+
+func (UnimplementedIP2CountryServiceServer) Lookup(context.Context, *LookupRequest) (*LookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedIP2CountryServiceServer) BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchLookup not implemented")
+}
+func (UnimplementedIP2CountryServiceServer) StreamLookup(*BatchLookupRequest, grpc.ServerStreamingServer[LookupResult]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLookup not implemented")
+}
+func (UnimplementedIP2CountryServiceServer) mustEmbedUnimplementedIP2CountryServiceServer() {}
+func (UnimplementedIP2CountryServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeIP2CountryServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IP2CountryServiceServer will
+// result in compilation errors.
+type UnsafeIP2CountryServiceServer interface {
+	mustEmbedUnimplementedIP2CountryServiceServer()
+}
+
+func RegisterIP2CountryServiceServer(s grpc.ServiceRegistrar, srv IP2CountryServiceServer) {
+	// If the following call pancis, it indicates UnimplementedIP2CountryServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IP2CountryService_ServiceDesc, srv)
+}
+
+func _IP2CountryService_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IP2CountryServiceServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IP2CountryService_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IP2CountryServiceServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IP2CountryService_BatchLookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchLookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IP2CountryServiceServer).BatchLookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IP2CountryService_BatchLookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IP2CountryServiceServer).BatchLookup(ctx, req.(*BatchLookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IP2CountryService_StreamLookup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BatchLookupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IP2CountryServiceServer).StreamLookup(m, &grpc.GenericServerStream[BatchLookupRequest, LookupResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IP2CountryService_StreamLookupServer = grpc.ServerStreamingServer[LookupResult]
+
+// IP2CountryService_ServiceDesc is the grpc.ServiceDesc for IP2CountryService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IP2CountryService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ip2country.v1.IP2CountryService",
+	HandlerType: (*IP2CountryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _IP2CountryService_Lookup_Handler,
+		},
+		{
+			MethodName: "BatchLookup",
+			Handler:    _IP2CountryService_BatchLookup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLookup",
+			Handler:       _IP2CountryService_StreamLookup_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ip2country/v1/ip2country.proto",
+}
@@ -2,8 +2,10 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"net"
+	"time"
 )
 
 var ErrNotFound = errors.New("not found")
@@ -13,11 +15,44 @@ type Store interface {
 	GetInfoByIP(ip net.IP) (*SubnetInfo, error)
 }
 
+// ContextStore Description: Optionally implemented by stores whose lookups can be cancelled or traced through a context.
+type ContextStore interface {
+	// GetInfoByIPContext is GetInfoByIP bound to ctx.
+	GetInfoByIPContext(ctx context.Context, ip net.IP) (*SubnetInfo, error)
+}
+
+// Source Description: Optionally implemented by stores that can describe where their answers come from.
+type Source interface {
+	// Name returns the data store type answering lookups, e.g. "local" or "api".
+	Name() string
+	// BuildDate returns when the underlying database was built, or the zero time if unknown.
+	BuildDate() time.Time
+}
+
+// RecordCounter Description: Optionally implemented by stores backed by a database of known size.
+type RecordCounter interface {
+	// RecordCount returns the number of networks in the database.
+	RecordCount() int
+}
+
+// Checker Description: Optionally implemented by stores that can tell whether they are able to serve lookups.
+type Checker interface {
+	// Ready returns an error describing why the store cannot serve lookups, or nil when it can.
+	Ready(ctx context.Context) error
+}
+
+// Closer Description: Optionally implemented by stores holding resources to release on shutdown.
+type Closer interface {
+	// Close releases the resources of the store. No lookups may be made afterwards.
+	Close()
+}
+
 // SubnetInfo holds information about each subnet
 type SubnetInfo struct {
-	Subnet  string // CIDR notation of the subnet
-	Country string // Country name associated with the subnet
-	City    string // City name associated with the subnet
+	Subnet      string // CIDR notation of the subnet
+	Country     string // Country name associated with the subnet
+	City        string // City name associated with the subnet
+	CountryCode string // ISO 3166-1 alpha-2 code of the country
 }
 
 type CustomTreeEntry struct {